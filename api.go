@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"game_exporter/collector"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// apiResponse 和Prometheus HTTP API相同的响应格式
+type apiResponse struct {
+	Status string      `json:"status"`
+	Data   interface{} `json:"data,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, code int, resp apiResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	// cmdline中常有&、<、>，不需要转义
+	enc.SetEscapeHTML(false)
+	enc.Encode(resp)
+}
+
+// processesHandler /api/v1/processes，每个进程配置匹配到的pid、cmdline、启动时间和资源使用
+func processesHandler(w http.ResponseWriter, r *http.Request) {
+	entries, err := collector.ProcessInventory(sc.Get())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiResponse{Status: "error", Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, apiResponse{Status: "success", Data: entries})
+}
+
+// collectorEntry /api/v1/collectors中的一个collector，还没执行过时没有last_*字段
+type collectorEntry struct {
+	Name                string     `json:"name"`
+	Help                string     `json:"help"`
+	Enabled             bool       `json:"enabled"`
+	LastScrape          *time.Time `json:"last_scrape,omitempty"`
+	LastDurationSeconds *float64   `json:"last_duration_seconds,omitempty"`
+	LastSuccess         *bool      `json:"last_success,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastErrorTime       *time.Time `json:"last_error_time,omitempty"`
+}
+
+// collectorsHandler /api/v1/collectors，所有collector是否启用以及最近一次执行的耗时和错误
+func collectorsHandler(scraperFlags map[collector.Scraper]*bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		statuses := make(map[string]collector.CollectorStatus)
+		for _, s := range collector.Statuses() {
+			statuses[s.Name] = s
+		}
+		entries := make([]collectorEntry, 0, len(scraperFlags))
+		for scraper, enabled := range scraperFlags {
+			entry := collectorEntry{
+				Name:    scraper.Name(),
+				Help:    scraper.Help(),
+				Enabled: *enabled,
+			}
+			if s, ok := statuses[scraper.Name()]; ok {
+				duration := s.LastDuration.Seconds()
+				entry.LastScrape = &s.LastScrape
+				entry.LastDurationSeconds = &duration
+				entry.LastSuccess = &s.LastSuccess
+				entry.LastError = s.LastError
+				if !s.LastErrorTime.IsZero() {
+					entry.LastErrorTime = &s.LastErrorTime
+				}
+			}
+			entries = append(entries, entry)
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].Name < entries[j].Name
+		})
+		writeJSON(w, http.StatusOK, apiResponse{Status: "success", Data: entries})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"game_exporter/collector"
+	"gopkg.in/yaml.v2"
+	"os"
+)
+
+// checkConfig validates the config file for the check-config command and
+// returns the exit code. With live set, the process matchers are evaluated
+// against the running processes as well. With printConfig set, the merged config
+// is printed with the secrets redacted.
+func checkConfig(path string, live, printConfig bool) int {
+	fmt.Printf("Checking %s\n", path)
+	c, err := collector.LoadConfig(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  FAILED: %s\n", err)
+		return 1
+	}
+	fmt.Printf("  SUCCESS: %d process entries, %d directories, %d file freshness checks, %d certificate entries\n",
+		len(c.Processnames), len(c.Directories), len(c.Freshness), len(c.Certificates))
+	for _, f := range c.Files() {
+		fmt.Printf("  loaded %s\n", f)
+	}
+	if printConfig {
+		out, err := yaml.Marshal(c)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  FAILED: printing config: %s\n", err)
+			return 1
+		}
+		fmt.Printf("%s", out)
+	}
+	if !live {
+		return 0
+	}
+
+	matched, err := collector.MatchedPIDs(c)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  FAILED: reading processes: %s\n", err)
+		return 1
+	}
+	owners := make(map[int][]string)
+	for _, v := range c.Processnames {
+		pids := matched[v.Name]
+		if len(pids) == 0 {
+			fmt.Printf("  %s: no matching process\n", v.Name)
+			continue
+		}
+		fmt.Printf("  %s: pids %v\n", v.Name, pids)
+		for _, pid := range pids {
+			owners[pid] = append(owners[pid], v.Name)
+		}
+	}
+	for pid, names := range owners {
+		if len(names) > 1 {
+			fmt.Printf("  WARNING: pid %d is matched by several entries %v\n", pid, names)
+		}
+	}
+	return 0
+}
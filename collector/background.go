@@ -0,0 +1,149 @@
+package collector
+
+import (
+	"context"
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"sync"
+	"time"
+)
+
+// minInterval 后台执行间隔的最小值，也是检查哪些collector到期的周期
+const minInterval = time.Second
+
+var snapshotAgeDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, exporter, "collector_snapshot_age_seconds"),
+	"Seconds since the cached result of a background collector was collected.",
+	[]string{"collector"}, nil,
+)
+
+// Background 按collectors.interval在后台执行collector并缓存结果，
+// 多个Prometheus副本和手动curl共享同一份结果，不会各自触发一次完整采集
+type Background struct {
+	config  *SafeConfig
+	metrics Metrics
+	logger  log.Logger
+	// 按名字索引的scraper，带参数的scraper和这里的不相等，仍然在抓取时执行
+	scrapers map[string]Scraper
+	names    []string
+
+	mu        sync.Mutex
+	snapshots map[string]*snapshot
+	running   map[string]bool
+	started   map[string]time.Time
+}
+
+// snapshot collector最近一次后台执行的结果，包括耗时、是否超时和是否成功的指标
+type snapshot struct {
+	metrics []prometheus.Metric
+	success bool
+	time    time.Time
+}
+
+// NewBackground 创建后台采集，需要调用Run才会开始执行
+func NewBackground(metrics Metrics, scrapers []Scraper, config *SafeConfig, logger log.Logger) *Background {
+	b := &Background{
+		config:    config,
+		metrics:   metrics,
+		logger:    logger,
+		scrapers:  make(map[string]Scraper, len(scrapers)),
+		snapshots: make(map[string]*snapshot),
+		running:   make(map[string]bool),
+		started:   make(map[string]time.Time),
+	}
+	for _, scraper := range scrapers {
+		b.scrapers[scraper.Name()] = scraper
+		b.names = append(b.names, scraper.Name())
+	}
+	return b
+}
+
+// New 返回一个Exporter，后台执行的collector输出缓存的结果，其余的在抓取时执行
+func (b *Background) New(ctx context.Context, scrapers []Scraper, config *MyConfig) *Exporter {
+	e := New(ctx, b.metrics, scrapers, config, b.logger)
+	e.background = b
+	return e
+}
+
+// Run 每秒检查一次哪些collector到了执行时间，ctx结束时返回
+// 间隔在每次检查时从当前配置读取，热加载后立即生效
+func (b *Background) Run(ctx context.Context) {
+	ticker := time.NewTicker(minInterval)
+	defer ticker.Stop()
+	for {
+		b.tick(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tick 启动到期的collector，上一次还在执行的跳过，超过max_concurrency的留到下一次检查
+func (b *Background) tick(ctx context.Context, now time.Time) {
+	config := b.config.Get()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, name := range b.names {
+		interval := config.Collectors.interval(name)
+		if interval <= 0 {
+			// 改为抓取时执行后，删除旧的结果，再改回后台执行时不会输出过期的数据
+			delete(b.snapshots, name)
+			delete(b.started, name)
+			continue
+		}
+		if b.running[name] || now.Sub(b.started[name]) < interval {
+			continue
+		}
+		if max := config.Collectors.MaxConcurrency; max > 0 && len(b.running) >= max {
+			return
+		}
+		b.running[name] = true
+		b.started[name] = now
+		go b.collect(ctx, b.scrapers[name], config, interval)
+	}
+}
+
+// collect 执行一次collector并替换缓存的结果
+// 没有配置collectors.timeout时以执行间隔作为超时，避免卡住的collector一直占用并发数
+func (b *Background) collect(ctx context.Context, scraper Scraper, config *MyConfig, interval time.Duration) {
+	if config.Collectors.timeout(scraper.Name()) == 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, interval)
+		defer cancel()
+	}
+	e := New(ctx, b.metrics, nil, config, b.logger)
+	ch := make(chan prometheus.Metric)
+	done := make(chan []prometheus.Metric)
+	go func() {
+		var metrics []prometheus.Metric
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		done <- metrics
+	}()
+	err := e.scrapeOne(ctx, scraper, ch)
+	close(ch)
+	s := &snapshot{metrics: <-done, success: err == nil, time: time.Now()}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.running, scraper.Name())
+	// 执行期间被热加载改为抓取时执行的，不保存结果
+	if _, ok := b.started[scraper.Name()]; ok {
+		b.snapshots[scraper.Name()] = s
+	}
+}
+
+// cached 返回后台执行的collector的缓存结果，还没有执行完第一次时为nil
+// scraper不在后台执行(interval为0或者带了参数)时ok为false
+func (b *Background) cached(scraper Scraper, collectors CollectorsConfig) (s *snapshot, ok bool) {
+	name := scraper.Name()
+	if b.scrapers[name] != scraper || collectors.interval(name) <= 0 {
+		return nil, false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.snapshots[name], true
+}
@@ -0,0 +1,245 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"io/ioutil"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	gameBuildInfo = "server_build_info"
+	// 执行版本命令的默认超时时间
+	defVersionCommandTimeout = 5 * time.Second
+)
+
+// VersionSource 对应process_names下的version，描述从哪里获取游戏服的版本号
+// file、cmdline、command三者只能配置一个
+type VersionSource struct {
+	// File 读取版本文件
+	File string `yaml:"file,omitempty"`
+	// Cmdline 从进程cmdline中用正则提取版本
+	Cmdline string `yaml:"cmdline,omitempty"`
+	// Command 执行命令(例如 gs -version)获取版本
+	Command []string `yaml:"command,omitempty"`
+	// Regex 作用于file内容或command输出，为空时取整个内容
+	Regex string `yaml:"regex,omitempty"`
+	// Timeout command的超时时间，默认5s
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+
+	// cmdline或regex编译后的正则，加载配置时生成
+	regexp *regexp.Regexp
+}
+
+// 正则中的命名分组(?P<version>...)和(?P<commit>...)，没有命名分组时第一个分组视为version
+const (
+	versionGroup = "version"
+	commitGroup  = "commit"
+)
+
+// buildInfo 缓存的版本信息，进程的pid或启动时间变化、或者热加载后版本来源变化时重新获取
+type buildInfo struct {
+	// source 获取版本时使用的配置，热加载会生成新的配置
+	source    *VersionSource
+	pid       int
+	startTime uint64
+	version   string
+	commit    string
+}
+
+var buildInfoCache = struct {
+	sync.Mutex
+	m map[string]buildInfo
+}{m: map[string]buildInfo{}}
+
+// ScrapeGameBuildInfo collects the version of configured game servers
+type ScrapeGameBuildInfo struct {
+	Config *SafeConfig
+	// filter 由procname参数设置，为nil时采集所有进程
+	filter *procnameFilter
+}
+
+// Name of the Scraper Unique
+func (ScrapeGameBuildInfo) Name() string {
+	return gameBuildInfo
+}
+
+// Version of config whitch scraper is avaliable
+func (ScrapeGameBuildInfo) Version() float64 {
+	return 1.0
+}
+
+// Help method of Scraper
+func (ScrapeGameBuildInfo) Help() string {
+	return "Scrape the build version of game processes from version files, cmdline or commands"
+}
+
+// Scrape method of Scraper
+func (s ScrapeGameBuildInfo) Scrape(ctx context.Context, ch chan<- prometheus.Metric, logger log.Logger) error {
+	configStruct := s.Config.Get()
+	procs, err := listProcesses()
+	if err != nil {
+		return err
+	}
+	buildInfoDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(configStruct.Namespace, "", gameBuildInfo),
+		"Build version of the game server process, the value is always 1.",
+		[]string{"procname", "version", "commit"}, nil,
+	)
+	var lastErr error
+	seen := make(map[string]bool)
+	for _, v := range configStruct.Processnames {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if v.Version == nil || !s.filter.match(v.Name) {
+			continue
+		}
+		matched := matchProcesses(v, procs)
+		if len(matched) == 0 {
+			// 进程没有运行，不输出版本
+			continue
+		}
+		seen[v.Name] = true
+		info, err := getBuildInfo(ctx, v, oldestProcess(matched))
+		if err != nil {
+			level.Error(logger).Log("msg", "Failed to get build info", "procname", v.Name, "err", err)
+			lastErr = err
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(buildInfoDesc, prometheus.GaugeValue, 1, v.Name, info.version, info.commit)
+	}
+	if s.filter == nil {
+		// 只采集部分进程时不能判断其他进程是否还在运行
+		pruneBuildInfoCache(seen)
+	}
+	return lastErr
+}
+
+// WithParams method of ParamScraper, procname limits the processes to scrape
+func (s ScrapeGameBuildInfo) WithParams(params url.Values) (Scraper, error) {
+	f, err := newProcnameFilter(s.Config.Get(), params)
+	if err != nil {
+		return nil, err
+	}
+	s.filter = f
+	return s, nil
+}
+
+// oldestProcess 多个进程匹配时，取最早启动的进程作为主进程
+func oldestProcess(procs []procInfo) procInfo {
+	oldest := procs[0]
+	for _, p := range procs[1:] {
+		if p.startTime < oldest.startTime {
+			oldest = p
+		}
+	}
+	return oldest
+}
+
+// getBuildInfo 优先使用缓存，进程重启或配置热加载后重新获取版本
+func getBuildInfo(ctx context.Context, info Info, proc procInfo) (buildInfo, error) {
+	buildInfoCache.Lock()
+	cached, ok := buildInfoCache.m[info.Name]
+	buildInfoCache.Unlock()
+	if ok && cached.source == info.Version && cached.pid == proc.pid && cached.startTime == proc.startTime {
+		return cached, nil
+	}
+	version, commit, err := resolveVersion(ctx, info.Version, proc)
+	if err != nil {
+		return buildInfo{}, err
+	}
+	result := buildInfo{
+		source:    info.Version,
+		pid:       proc.pid,
+		startTime: proc.startTime,
+		version:   version,
+		commit:    commit,
+	}
+	buildInfoCache.Lock()
+	buildInfoCache.m[info.Name] = result
+	buildInfoCache.Unlock()
+	return result, nil
+}
+
+// pruneBuildInfoCache 删除已经不在运行的进程的缓存
+func pruneBuildInfoCache(seen map[string]bool) {
+	buildInfoCache.Lock()
+	defer buildInfoCache.Unlock()
+	for name := range buildInfoCache.m {
+		if !seen[name] {
+			delete(buildInfoCache.m, name)
+		}
+	}
+}
+
+// resolveVersion 按照配置的来源读取版本号和commit，command在ctx结束或超时后被kill
+func resolveVersion(ctx context.Context, src *VersionSource, proc procInfo) (version, commit string, err error) {
+	switch {
+	case src.File != "":
+		data, err := ioutil.ReadFile(src.File)
+		if err != nil {
+			return "", "", err
+		}
+		return extractVersion(src.regexp, string(data))
+	case src.Cmdline != "":
+		return extractVersion(src.regexp, proc.cmdline)
+	case len(src.Command) > 0:
+		timeout := src.Timeout
+		if timeout <= 0 {
+			timeout = defVersionCommandTimeout
+		}
+		cmdCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		out, err := exec.CommandContext(cmdCtx, src.Command[0], src.Command[1:]...).Output()
+		if ctx.Err() != nil {
+			// 整个scrape超时或被取消
+			return "", "", fmt.Errorf("version command %q canceled: %w", strings.Join(src.Command, " "), ctx.Err())
+		}
+		if cmdCtx.Err() != nil {
+			return "", "", fmt.Errorf("version command %q timed out after %s", strings.Join(src.Command, " "), timeout)
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("version command %q failed: %w", strings.Join(src.Command, " "), err)
+		}
+		return extractVersion(src.regexp, string(out))
+	}
+	return "", "", errors.New("version source needs one of file, cmdline or command")
+}
+
+// extractVersion 用正则从内容中提取version和commit，正则为空时整个内容即为version
+func extractVersion(re *regexp.Regexp, content string) (version, commit string, err error) {
+	if re == nil {
+		return strings.TrimSpace(content), "", nil
+	}
+	match := re.FindStringSubmatch(content)
+	if match == nil {
+		return "", "", fmt.Errorf("version regex %q does not match", re)
+	}
+	for i, name := range re.SubexpNames() {
+		switch name {
+		case versionGroup:
+			version = match[i]
+		case commitGroup:
+			commit = match[i]
+		}
+	}
+	if version == "" && len(match) > 1 && re.SubexpNames()[1] == "" {
+		version = match[1]
+	}
+	if version == "" {
+		version = match[0]
+	}
+	return version, commit, nil
+}
+
+var _ ParamScraper = ScrapeGameBuildInfo{}
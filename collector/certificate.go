@@ -0,0 +1,184 @@
+package collector
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	tlsCert = "tls_cert"
+)
+
+// CertInfo 对应certificates下的配置，paths可以是文件路径或glob
+type CertInfo struct {
+	Name  string   `yaml:"name,omitempty"`
+	Paths []string `yaml:"paths"`
+}
+
+// certDescs 证书的指标描述，namespace来自配置
+type certDescs struct {
+	notAfter   *prometheus.Desc
+	notBefore  *prometheus.Desc
+	expiryDays *prometheus.Desc
+	info       *prometheus.Desc
+}
+
+func newCertDescs(ns string) certDescs {
+	certLabels := []string{"name", "path", "serial"}
+	return certDescs{
+		notAfter: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, tlsCert, "not_after_seconds"),
+			"NotAfter of the certificate, in unixtime.",
+			certLabels, nil,
+		),
+		notBefore: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, tlsCert, "not_before_seconds"),
+			"NotBefore of the certificate, in unixtime.",
+			certLabels, nil,
+		),
+		expiryDays: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, tlsCert, "days_until_expiry"),
+			"Days until the certificate expires, negative when it has already expired.",
+			certLabels, nil,
+		),
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, tlsCert, "info"),
+			"Subject, issuer and SANs of the certificate, the value is always 1.",
+			append(certLabels, "subject", "issuer", "sans"), nil,
+		),
+	}
+}
+
+// ScrapeCertificateInfo collects expiry of certificates stored on the host
+type ScrapeCertificateInfo struct {
+	Config *SafeConfig
+}
+
+// Name method of Scraper
+func (ScrapeCertificateInfo) Name() string {
+	return tlsCert
+}
+
+// Help method of Scraper
+func (ScrapeCertificateInfo) Help() string {
+	return "Scrape expiry, subject, issuer and SANs of PEM/DER certificates from configured paths and globs"
+}
+
+// Version method of Scraper
+func (ScrapeCertificateInfo) Version() float64 {
+	return 1.0
+}
+
+// Scrape method of Scraper
+func (s ScrapeCertificateInfo) Scrape(ctx context.Context, ch chan<- prometheus.Metric, logger log.Logger) error {
+	configStruct := s.Config.Get()
+	descs := newCertDescs(configStruct.Namespace)
+	var lastErr error
+	now := time.Now()
+	// 同一个文件可能被多个配置的path或glob匹配到，相同的name、path、serial只输出一次
+	seen := make(map[[3]string]bool)
+	for _, v := range configStruct.Certificates {
+		files, err := certificateFiles(v.Paths)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, file := range files {
+			certs, err := readCertificates(file)
+			if err != nil {
+				level.Error(logger).Log("msg", "Failed to read certificate", "path", file, "err", err)
+				lastErr = err
+				continue
+			}
+			if len(certs) == 0 {
+				// glob常会匹配到同目录下的privkey.pem等文件
+				level.Debug(logger).Log("msg", "Skipping PEM file without certificate", "path", file)
+				continue
+			}
+			for _, cert := range certs {
+				key := [3]string{v.Name, file, cert.SerialNumber.String()}
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				labels := key[:]
+				ch <- prometheus.MustNewConstMetric(descs.notAfter, prometheus.GaugeValue, float64(cert.NotAfter.Unix()), labels...)
+				ch <- prometheus.MustNewConstMetric(descs.notBefore, prometheus.GaugeValue, float64(cert.NotBefore.Unix()), labels...)
+				ch <- prometheus.MustNewConstMetric(descs.expiryDays, prometheus.GaugeValue, cert.NotAfter.Sub(now).Hours()/24, labels...)
+				ch <- prometheus.MustNewConstMetric(descs.info, prometheus.GaugeValue, 1,
+					append(labels, cert.Subject.String(), cert.Issuer.String(), certSANs(cert))...)
+			}
+		}
+	}
+	return lastErr
+}
+
+// certificateFiles 展开paths中的glob，去掉重复的文件
+func certificateFiles(paths []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	for _, p := range paths {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate glob %q: %w", p, err)
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				files = append(files, m)
+			}
+		}
+	}
+	return files, nil
+}
+
+// readCertificates 解析PEM(可能包含证书链和私钥)或DER格式的证书文件，
+// 只有私钥等其他块的PEM文件返回空列表
+func readCertificates(file string) ([]*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.Contains(string(data), "-----BEGIN") {
+		return x509.ParseCertificates(data)
+	}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			// 私钥等其他PEM块
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	return certs, nil
+}
+
+// certSANs 将DNS、IP和邮箱SAN合并为逗号分隔的字符串
+func certSANs(cert *x509.Certificate) string {
+	sans := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	return strings.Join(sans, ",")
+}
+
+var _ Scraper = ScrapeCertificateInfo{}
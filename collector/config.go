@@ -0,0 +1,409 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MyConfig config结构体 ，对应yaml的process_name
+type MyConfig struct {
+	// Include 只能写在主配置文件中，引入其他配置片段的glob，相对路径相对于主配置文件所在目录
+	Include []string `yaml:"include,omitempty"`
+	// Namespace 采集指标的前缀，默认为game；exporter自身的指标固定为game_exporter
+	Namespace string `yaml:"namespace,omitempty"`
+	// Labels 加到exporter输出的所有指标上的静态标签，例如region、zone、game、idc
+	Labels       map[string]string `yaml:"labels,omitempty"`
+	Collectors   CollectorsConfig  `yaml:"collectors,omitempty"`
+	Processnames []Info            `yaml:"process_names"`
+	Directories  []DirInfo         `yaml:"directories,omitempty"`
+	Freshness    []FreshnessInfo   `yaml:"file_freshness,omitempty"`
+	Certificates []CertInfo        `yaml:"certificates,omitempty"`
+	// ProbeModules /probe使用的探测模块，key为module参数
+	ProbeModules map[string]ProbeModule `yaml:"probe_modules,omitempty"`
+	// MetricRelabelConfigs 输出前对exporter的指标执行的relabel规则，用于在本机减少序列数
+	MetricRelabelConfigs []RelabelConfig `yaml:"metric_relabel_configs,omitempty"`
+
+	// 加载的所有配置文件
+	files []string
+	// namespace、labels、collectors和metric_relabel_configs所在的配置文件，用于检查多个文件重复设置
+	namespaceSource, labelsSource, collectorsSource, relabelSource string
+}
+
+// Info 结构体，对应process_names下的-name和cmdline
+type Info struct {
+	Name    string         `yaml:"name"`
+	Cmdline []string       `yaml:"cmdline"`
+	Version *VersionSource `yaml:"version,omitempty"`
+	// Labels 加到该进程指标(带procname标签)上的静态标签，例如server_id、open_date、channel
+	Labels map[string]string `yaml:"labels,omitempty"`
+
+	// cmdline编译后的正则，加载配置时生成
+	cmdlineRegexps []*regexp.Regexp
+	// 该配置所在的文件
+	source string
+}
+
+// CollectorsConfig 对应yaml的collectors，各个collector的可调参数
+type CollectorsConfig struct {
+	Filesystem FilesystemConfig `yaml:"filesystem,omitempty"`
+	Netdev     NetdevConfig     `yaml:"netdev,omitempty"`
+	CPU        CPUConfig        `yaml:"cpu,omitempty"`
+	// Timeout 每个collector的默认超时时间，为0时只受Prometheus抓取超时的限制
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Timeouts 单独设置某个collector的超时时间，key为--collect.<name>中的name
+	Timeouts map[string]time.Duration `yaml:"timeouts,omitempty"`
+	// Interval 大于0时collector在后台按这个间隔执行，/metrics输出最近一次的结果，为0时每次抓取都执行
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// Intervals 单独设置某个collector的后台执行间隔，为0表示该collector每次抓取时执行
+	Intervals map[string]time.Duration `yaml:"intervals,omitempty"`
+	// MaxConcurrency 后台同时执行的collector数量，为0时不限制
+	MaxConcurrency int `yaml:"max_concurrency,omitempty"`
+}
+
+// collectorNames 已注册的collector名称，用于校验collectors.timeouts和collectors.intervals的key
+var collectorNames map[string]bool
+
+// SetCollectorNames 设置已注册的collector名称，需要在加载配置之前调用；
+// 未设置时不校验timeouts和intervals的key
+func SetCollectorNames(names ...string) {
+	collectorNames = make(map[string]bool, len(names))
+	for _, name := range names {
+		collectorNames[name] = true
+	}
+}
+
+// checkCollectorName 检查name是否为已注册的collector
+func checkCollectorName(field, name string) error {
+	if collectorNames == nil || collectorNames[name] {
+		return nil
+	}
+	known := make([]string, 0, len(collectorNames))
+	for n := range collectorNames {
+		known = append(known, n)
+	}
+	sort.Strings(known)
+	return fmt.Errorf("%s %q: unknown collector, must be one of %s", field, name, strings.Join(known, ", "))
+}
+
+// timeout 返回collector的超时时间，0表示不单独限制
+func (c CollectorsConfig) timeout(name string) time.Duration {
+	if t, ok := c.Timeouts[name]; ok {
+		return t
+	}
+	return c.Timeout
+}
+
+// interval 返回collector的后台执行间隔，0表示每次抓取时执行
+func (c CollectorsConfig) interval(name string) time.Duration {
+	if i, ok := c.Intervals[name]; ok {
+		return i
+	}
+	return c.Interval
+}
+
+// SafeConfig 保存当前生效的配置，热加载时只有新配置校验通过才会替换
+type SafeConfig struct {
+	sync.RWMutex
+	C *MyConfig
+}
+
+var (
+	namespaceFlag = kingpin.Flag(
+		"collector.namespace",
+		"Metric namespace of the collectors, overrides namespace in the config file.",
+	).String()
+
+	configReloadSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: exporter,
+		Name:      "config_last_reload_successful",
+		Help:      "Whether the last configuration reload attempt was successful (1 for success, 0 for failure).",
+	})
+	configReloadSeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: exporter,
+		Name:      "config_last_reload_success_timestamp_seconds",
+		Help:      "Timestamp of the last successful configuration reload.",
+	})
+	configInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: exporter,
+		Name:      "config_info",
+		Help:      "Source file of each process entry in the loaded configuration, the value is always 1.",
+	}, []string{"procname", "file"})
+)
+
+func init() {
+	prometheus.MustRegister(configReloadSuccess)
+	prometheus.MustRegister(configReloadSeconds)
+	prometheus.MustRegister(configInfo)
+}
+
+// NewSafeConfig 返回一个空配置，需要调用ReloadConfig加载配置文件
+func NewSafeConfig() *SafeConfig {
+	return &SafeConfig{C: &MyConfig{}}
+}
+
+// ReloadConfig 重新读取配置文件，校验失败时继续使用旧的配置
+func (sc *SafeConfig) ReloadConfig(fileName string) error {
+	c, err := LoadConfig(fileName)
+	if err != nil {
+		configReloadSuccess.Set(0)
+		return err
+	}
+	sc.Lock()
+	sc.C = c
+	sc.Unlock()
+	configReloadSuccess.Set(1)
+	configReloadSeconds.SetToCurrentTime()
+	configInfo.Reset()
+	for _, v := range c.Processnames {
+		configInfo.WithLabelValues(v.Name, v.source).Set(1)
+	}
+	return nil
+}
+
+// Get 返回当前生效的配置
+func (sc *SafeConfig) Get() *MyConfig {
+	sc.RLock()
+	defer sc.RUnlock()
+	return sc.C
+}
+
+// Files 返回加载的所有配置文件
+func (c *MyConfig) Files() []string {
+	return c.files
+}
+
+// finalize 填充全局配置的默认值并应用命令行参数，在所有配置文件合并后调用
+func (c *MyConfig) finalize() error {
+	if c.Namespace == "" {
+		c.Namespace = namespace
+	}
+	if *namespaceFlag != "" {
+		c.Namespace = *namespaceFlag
+	}
+	if !metricNameRE.MatchString(c.Namespace) {
+		return fmt.Errorf("namespace %q is not a valid metric name prefix", c.Namespace)
+	}
+	if err := validateLabels(c.Labels, nil); err != nil {
+		return fmt.Errorf("labels: %w", err)
+	}
+	for i, v := range c.Processnames {
+		if err := validateLabels(v.Labels, c.Labels); err != nil {
+			return fmt.Errorf("process_names[%d] %q in %s: labels: %w", i, v.Name, v.source, err)
+		}
+	}
+	if err := c.Collectors.Filesystem.validate(); err != nil {
+		return fmt.Errorf("collectors.filesystem: %w", err)
+	}
+	if err := c.Collectors.Netdev.validate(); err != nil {
+		return fmt.Errorf("collectors.netdev: %w", err)
+	}
+	if err := c.Collectors.CPU.validate(); err != nil {
+		return fmt.Errorf("collectors.cpu: %w", err)
+	}
+	// name和glob相同的file_freshness会输出重复的指标，name为空时使用glob
+	freshness := make(map[[2]string]int, len(c.Freshness))
+	for i, v := range c.Freshness {
+		key := [2]string{v.Name, v.Glob}
+		if v.Name == "" {
+			key[0] = v.Glob
+		}
+		if j, ok := freshness[key]; ok {
+			return fmt.Errorf("file_freshness[%d] %q: same name and glob as file_freshness[%d]", i, v.Name, j)
+		}
+		freshness[key] = i
+	}
+	if c.Collectors.Timeout < 0 {
+		return errors.New("collectors.timeout must not be negative")
+	}
+	for name, t := range c.Collectors.Timeouts {
+		if err := checkCollectorName("collectors.timeouts", name); err != nil {
+			return err
+		}
+		if t <= 0 {
+			return fmt.Errorf("collectors.timeouts %q must be positive", name)
+		}
+	}
+	if i := c.Collectors.Interval; i < 0 || (i > 0 && i < minInterval) {
+		return fmt.Errorf("collectors.interval must be 0 or at least %s", minInterval)
+	}
+	for name, i := range c.Collectors.Intervals {
+		if err := checkCollectorName("collectors.intervals", name); err != nil {
+			return err
+		}
+		if i < 0 || (i > 0 && i < minInterval) {
+			return fmt.Errorf("collectors.intervals %q must be 0 or at least %s", name, minInterval)
+		}
+	}
+	if c.Collectors.MaxConcurrency < 0 {
+		return errors.New("collectors.max_concurrency must not be negative")
+	}
+	return nil
+}
+
+// validateEntries 校验单个配置文件中的各项配置并编译其中的正则，错误信息中包含出错的配置项
+// baseDir为配置文件所在目录，用于读取相对路径的secret文件
+func (c *MyConfig) validateEntries(baseDir string) error {
+	for i := range c.Processnames {
+		v := &c.Processnames[i]
+		if err := v.validate(); err != nil {
+			return fmt.Errorf("process_names[%d] %q: %w", i, v.Name, err)
+		}
+	}
+	for i, v := range c.Directories {
+		if v.Path == "" {
+			return fmt.Errorf("directories[%d]: path is required", i)
+		}
+	}
+	for i, v := range c.Freshness {
+		if err := validateGlob(v.Glob); err != nil {
+			return fmt.Errorf("file_freshness[%d] %q: %w", i, v.Name, err)
+		}
+	}
+	for i, v := range c.Certificates {
+		if len(v.Paths) == 0 {
+			return fmt.Errorf("certificates[%d] %q: paths is required", i, v.Name)
+		}
+		for _, p := range v.Paths {
+			if err := validateGlob(p); err != nil {
+				return fmt.Errorf("certificates[%d] %q: %w", i, v.Name, err)
+			}
+		}
+	}
+	for name, m := range c.ProbeModules {
+		if err := m.validate(baseDir); err != nil {
+			return fmt.Errorf("probe_modules %q: %w", name, err)
+		}
+		c.ProbeModules[name] = m
+	}
+	for i := range c.MetricRelabelConfigs {
+		if err := c.MetricRelabelConfigs[i].validate(); err != nil {
+			return fmt.Errorf("metric_relabel_configs[%d]: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (i *Info) validate() error {
+	if i.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(i.Cmdline) == 0 || len(i.Cmdline) > 2 {
+		return fmt.Errorf("cmdline needs one or two patterns, got %d", len(i.Cmdline))
+	}
+	i.cmdlineRegexps = make([]*regexp.Regexp, 0, len(i.Cmdline))
+	for _, c := range i.Cmdline {
+		re, err := regexp.Compile(c)
+		if err != nil {
+			return fmt.Errorf("invalid cmdline pattern %q: %w", c, err)
+		}
+		i.cmdlineRegexps = append(i.cmdlineRegexps, re)
+	}
+	if i.Version != nil {
+		return i.Version.validate()
+	}
+	return nil
+}
+
+// matches 进程cmdline是否匹配所有的cmdline正则
+func (i Info) matches(cmdline string) bool {
+	if len(i.cmdlineRegexps) == 0 {
+		return false
+	}
+	for _, re := range i.cmdlineRegexps {
+		if !re.MatchString(cmdline) {
+			return false
+		}
+	}
+	return true
+}
+
+func (v *VersionSource) validate() error {
+	sources := 0
+	for _, set := range []bool{v.File != "", v.Cmdline != "", len(v.Command) > 0} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return errors.New("version needs exactly one of file, cmdline or command")
+	}
+	pattern := v.Regex
+	if v.Cmdline != "" {
+		pattern = v.Cmdline
+	}
+	if pattern == "" {
+		return nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid version regex %q: %w", pattern, err)
+	}
+	v.regexp = re
+	return nil
+}
+
+var metricNameRE = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// compileOptional 编译可选的正则，为空时返回nil
+func compileOptional(field, pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %w", field, pattern, err)
+	}
+	return re, nil
+}
+
+// optionalString 可选的字符串命令行参数，能区分未设置和显式设置为空字符串
+type optionalString struct {
+	value *string
+}
+
+func (o *optionalString) Set(s string) error {
+	o.value = &s
+	return nil
+}
+
+func (o *optionalString) String() string {
+	if o.value == nil {
+		return ""
+	}
+	return *o.value
+}
+
+func optionalStringFlag(name, help string) *optionalString {
+	o := &optionalString{}
+	kingpin.Flag(name, help).SetValue(o)
+	return o
+}
+
+// orDefault 未设置(nil)时返回默认值，显式设置为空字符串时保留空字符串
+func orDefault(s *string, def string) *string {
+	if s == nil {
+		return &def
+	}
+	return s
+}
+
+func validateGlob(pattern string) error {
+	if pattern == "" {
+		return errors.New("glob is required")
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid glob %q: %w", pattern, err)
+	}
+	return nil
+}
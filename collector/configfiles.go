@@ -0,0 +1,199 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+)
+
+// LoadConfig 读取并校验配置，返回编译好正则的配置
+// path可以是单个配置文件(可以用include引入其他配置片段)，也可以是conf.d目录，目录下所有*.yaml和*.yml文件会被合并
+// 配置中出现未知字段(例如拼写错误)也视为错误，启动、热加载和check-config使用同样的校验
+func LoadConfig(path string) (*MyConfig, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+	merged := new(MyConfig)
+	var fragments []string
+	if info.IsDir() {
+		if fragments, err = configDirFiles(path); err != nil {
+			return nil, err
+		}
+		if len(fragments) == 0 {
+			return nil, fmt.Errorf("no *.yaml or *.yml file in config directory %s", path)
+		}
+	} else {
+		main, err := loadConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := merged.merge(main); err != nil {
+			return nil, err
+		}
+		if fragments, err = includeFiles(filepath.Dir(path), main.Include); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+	for _, f := range fragments {
+		c, err := loadConfigFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if len(c.Include) > 0 {
+			return nil, fmt.Errorf("invalid config file %s: include is only allowed in the main config file", f)
+		}
+		if err := merged.merge(c); err != nil {
+			return nil, err
+		}
+	}
+	if err := merged.finalize(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return merged, nil
+}
+
+// loadConfigFile 解析并校验单个配置文件
+func loadConfigFile(fileName string) (*MyConfig, error) {
+	yamlInfo, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+	var myconfig = new(MyConfig)
+	if err := yaml.UnmarshalStrict(yamlInfo, myconfig); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", fileName, err)
+	}
+	if err := expandEnv(myconfig); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", fileName, err)
+	}
+	if err := myconfig.validateEntries(filepath.Dir(fileName)); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", fileName, err)
+	}
+	myconfig.files = []string{fileName}
+	for i := range myconfig.Processnames {
+		myconfig.Processnames[i].source = fileName
+	}
+	for name, m := range myconfig.ProbeModules {
+		m.source = fileName
+		myconfig.ProbeModules[name] = m
+	}
+	if myconfig.Namespace != "" {
+		myconfig.namespaceSource = fileName
+	}
+	if len(myconfig.Labels) > 0 {
+		myconfig.labelsSource = fileName
+	}
+	if !reflect.DeepEqual(myconfig.Collectors, CollectorsConfig{}) {
+		myconfig.collectorsSource = fileName
+	}
+	if len(myconfig.MetricRelabelConfigs) > 0 {
+		myconfig.relabelSource = fileName
+	}
+	return myconfig, nil
+}
+
+// merge 将一个配置文件合并进来，检查重复的进程名(同一文件内和跨文件)和重复设置的全局配置
+func (c *MyConfig) merge(o *MyConfig) error {
+	file := o.files[0]
+	if o.namespaceSource != "" {
+		if c.namespaceSource != "" {
+			return fmt.Errorf("invalid config file %s: namespace already set in %s", file, c.namespaceSource)
+		}
+		c.Namespace, c.namespaceSource = o.Namespace, o.namespaceSource
+	}
+	if o.labelsSource != "" {
+		if c.labelsSource != "" {
+			return fmt.Errorf("invalid config file %s: labels already set in %s", file, c.labelsSource)
+		}
+		c.Labels, c.labelsSource = o.Labels, o.labelsSource
+	}
+	if o.collectorsSource != "" {
+		if c.collectorsSource != "" {
+			return fmt.Errorf("invalid config file %s: collectors already set in %s", file, c.collectorsSource)
+		}
+		c.Collectors, c.collectorsSource = o.Collectors, o.collectorsSource
+	}
+	if o.relabelSource != "" {
+		if c.relabelSource != "" {
+			return fmt.Errorf("invalid config file %s: metric_relabel_configs already set in %s", file, c.relabelSource)
+		}
+		c.MetricRelabelConfigs, c.relabelSource = o.MetricRelabelConfigs, o.relabelSource
+	}
+	for i, v := range o.Processnames {
+		for j, prev := range o.Processnames[:i] {
+			if prev.Name == v.Name {
+				return fmt.Errorf("invalid config file %s: process_names[%d] %q: name already used in process_names[%d]", file, i, v.Name, j)
+			}
+		}
+		for _, existing := range c.Processnames {
+			if existing.Name == v.Name {
+				return fmt.Errorf("invalid config file %s: process_names[%d] %q: name already used in %s", file, i, v.Name, existing.source)
+			}
+		}
+	}
+	for name, m := range o.ProbeModules {
+		if existing, ok := c.ProbeModules[name]; ok {
+			return fmt.Errorf("invalid config file %s: probe_modules %q: name already used in %s", file, name, existing.source)
+		}
+		if c.ProbeModules == nil {
+			c.ProbeModules = make(map[string]ProbeModule)
+		}
+		c.ProbeModules[name] = m
+	}
+	c.Include = append(c.Include, o.Include...)
+	c.Processnames = append(c.Processnames, o.Processnames...)
+	c.Directories = append(c.Directories, o.Directories...)
+	c.Freshness = append(c.Freshness, o.Freshness...)
+	c.Certificates = append(c.Certificates, o.Certificates...)
+	c.files = append(c.files, file)
+	return nil
+}
+
+// configDirFiles 返回conf.d目录下按文件名排序的配置文件
+func configDirFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config directory: %w", err)
+	}
+	var files []string
+	for _, e := range entries {
+		ext := filepath.Ext(e.Name())
+		if e.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		files = append(files, filepath.Join(dir, e.Name()))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// includeFiles 展开include中的glob，相对路径相对于主配置文件所在目录
+func includeFiles(baseDir string, patterns []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return nil, errors.New("empty include pattern")
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(baseDir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include %q: %w", pattern, err)
+		}
+		sort.Strings(matches)
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				files = append(files, m)
+			}
+		}
+	}
+	return files, nil
+}
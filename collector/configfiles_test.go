@@ -0,0 +1,134 @@
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeConfigs 在临时目录中写入配置文件，返回目录
+func writeConfigs(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "game_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadConfigDuplicateNames(t *testing.T) {
+	cases := []struct {
+		name  string
+		files map[string]string
+		path  string
+		err   string
+	}{
+		{
+			name: "same file",
+			files: map[string]string{
+				"game.yaml": "process_names:\n  - name: gs1\n    cmdline: [gs1]\n  - name: gs1\n    cmdline: [gs2]\n",
+			},
+			path: "game.yaml",
+			err:  `process_names[1] "gs1": name already used in process_names[0]`,
+		},
+		{
+			name: "across conf.d files",
+			files: map[string]string{
+				"a.yaml": "process_names:\n  - name: gs1\n    cmdline: [gs1]\n",
+				"b.yaml": "process_names:\n  - name: gs1\n    cmdline: [gs2]\n",
+			},
+			path: ".",
+			err:  `process_names[0] "gs1": name already used in`,
+		},
+		{
+			name: "unique names",
+			files: map[string]string{
+				"a.yaml": "process_names:\n  - name: gs1\n    cmdline: [gs1]\n  - name: gs2\n    cmdline: [gs2]\n",
+				"b.yaml": "process_names:\n  - name: gs3\n    cmdline: [gs3]\n",
+			},
+			path: ".",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := writeConfigs(t, c.files)
+			config, err := LoadConfig(filepath.Join(dir, c.path))
+			if c.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if len(config.Processnames) != 3 {
+					t.Fatalf("expected 3 process entries, got %d", len(config.Processnames))
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Fatalf("expected error containing %q, got %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestMergeGlobalSettings(t *testing.T) {
+	a := &MyConfig{Namespace: "game", namespaceSource: "a.yaml", files: []string{"a.yaml"}}
+	b := &MyConfig{Namespace: "other", namespaceSource: "b.yaml", files: []string{"b.yaml"}}
+	merged := new(MyConfig)
+	if err := merged.merge(a); err != nil {
+		t.Fatal(err)
+	}
+	err := merged.merge(b)
+	if err == nil || !strings.Contains(err.Error(), "namespace already set in a.yaml") {
+		t.Fatalf("expected duplicate namespace error, got %v", err)
+	}
+}
+
+func TestLoadConfigEmptyExclude(t *testing.T) {
+	dir := writeConfigs(t, map[string]string{
+		"game.yaml": "collectors:\n  filesystem:\n    mount_points_exclude: ''\n  netdev:\n    device_include: ''\n",
+	})
+	config, err := LoadConfig(filepath.Join(dir, "game.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, netdev := config.Collectors.Filesystem, config.Collectors.Netdev
+	if fs.mountPointsExclude != nil || netdev.deviceInclude != nil {
+		t.Fatal("expected an empty value to disable the default regexp")
+	}
+	if *fs.FSTypesExclude != defIgnoredFSTypes || *netdev.DeviceExclude != defIgnoredDevices {
+		t.Fatal("expected unset excludes to use the defaults")
+	}
+}
+
+func TestLoadConfigUnknownCollector(t *testing.T) {
+	SetCollectorNames("game_linux_process_num", "tls_cert")
+	defer func() { collectorNames = nil }()
+	dir := writeConfigs(t, map[string]string{
+		"good.yaml": "collectors:\n  timeouts:\n    game_linux_process_num: 5s\n  intervals:\n    tls_cert: 30s\n",
+		"bad.yaml":  "collectors:\n  intervals:\n    process: 30s\n",
+	})
+	if _, err := LoadConfig(filepath.Join(dir, "good.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadConfig(filepath.Join(dir, "bad.yaml"))
+	if err == nil || !strings.Contains(err.Error(), `collectors.intervals "process": unknown collector`) {
+		t.Fatalf("expected unknown collector error, got %v", err)
+	}
+}
+
+func TestLoadConfigUnknownField(t *testing.T) {
+	dir := writeConfigs(t, map[string]string{
+		"game.yaml": "proces_names:\n  - name: gs1\n    cmdline: [gs1]\n",
+	})
+	_, err := LoadConfig(filepath.Join(dir, "game.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "field proces_names not found") {
+		t.Fatalf("expected unknown field error, got %v", err)
+	}
+}
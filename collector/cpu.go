@@ -1,10 +1,13 @@
 package collector
 
 import (
+	"fmt"
 	"github.com/go-kit/kit/log"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/procfs"
+	"gopkg.in/alecthomas/kingpin.v2"
 	"strconv"
+	"strings"
 	"sync"
 )
 
@@ -21,7 +24,65 @@ const (
 	linuxCpu = "linux_cpu_info"
 )
 
-type ScrapeCpuInfo struct{}
+var cpuModesFlag = kingpin.Flag(
+	"collector.cpu.modes",
+	"Comma separated CPU modes to export, overrides collectors.cpu.modes in the config file.",
+).String()
+
+// 默认输出的cpu模式
+var defCPUModes = []string{"user", "system", "idle"}
+
+// CPUConfig 对应collectors下的cpu
+type CPUConfig struct {
+	Modes []string `yaml:"modes,omitempty"`
+}
+
+// validate 填充默认值、应用命令行参数并检查cpu模式
+func (c *CPUConfig) validate() error {
+	if len(c.Modes) == 0 {
+		c.Modes = defCPUModes
+	}
+	if *cpuModesFlag != "" {
+		c.Modes = strings.Split(*cpuModesFlag, ",")
+	}
+	for _, mode := range c.Modes {
+		if _, ok := cpuModeValue(procfs.CPUStat{}, mode); !ok {
+			return fmt.Errorf("unknown cpu mode %q", mode)
+		}
+	}
+	return nil
+}
+
+// cpuModeValue 返回cpu模式对应的时间
+func cpuModeValue(stat procfs.CPUStat, mode string) (float64, bool) {
+	switch mode {
+	case "user":
+		return stat.User, true
+	case "nice":
+		return stat.Nice, true
+	case "system":
+		return stat.System, true
+	case "idle":
+		return stat.Idle, true
+	case "iowait":
+		return stat.Iowait, true
+	case "irq":
+		return stat.IRQ, true
+	case "softirq":
+		return stat.SoftIRQ, true
+	case "steal":
+		return stat.Steal, true
+	case "guest":
+		return stat.Guest, true
+	case "guest_nice":
+		return stat.GuestNice, true
+	}
+	return 0, false
+}
+
+type ScrapeCpuInfo struct {
+	Config *SafeConfig
+}
 
 func (ScrapeCpuInfo) Name() string {
 	return linuxCpu
@@ -34,7 +95,8 @@ func (ScrapeCpuInfo) Help() string {
 	return "Scrape Cpu info."
 }
 
-func (ScrapeCpuInfo) Scrape(ch chan<- prometheus.Metric, logger log.Logger) error {
+func (s ScrapeCpuInfo) Scrape(ch chan<- prometheus.Metric, logger log.Logger) error {
+	configStruct := s.Config.Get()
 	fs, err := procfs.NewFS("/proc")
 	if err != nil {
 		return err
@@ -48,7 +110,7 @@ func (ScrapeCpuInfo) Scrape(ch chan<- prometheus.Metric, logger log.Logger) erro
 		//	[]string{"package", "core", "cpu", "vendor", "family", "model", "model_name", "microcode", "stepping", "cachesize"}, nil,
 		//),
 		cpu: prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, linuxCpu, "seconds_total"),
+			prometheus.BuildFQName(configStruct.Namespace, linuxCpu, "seconds_total"),
 			"Seconds the CPUs spent in each mode.",
 			[]string{"cpu", "mode"}, nil,
 		),
@@ -62,10 +124,10 @@ func (ScrapeCpuInfo) Scrape(ch chan<- prometheus.Metric, logger log.Logger) erro
 	defer c.cpuStatMutex.Unlock()
 	for cpuID, cpuStat := range newStat {
 		cpuNum := strconv.Itoa(cpuID)
-		ch <- prometheus.MustNewConstMetric(c.cpu, prometheus.CounterValue, cpuStat.User, cpuNum, "user")
-		//ch <- prometheus.MustNewConstMetric(c.cpu, prometheus.CounterValue, cpuStat.Nice, cpuNum, "nice")
-		ch <- prometheus.MustNewConstMetric(c.cpu, prometheus.CounterValue, cpuStat.System, cpuNum, "system")
-		ch <- prometheus.MustNewConstMetric(c.cpu, prometheus.CounterValue, cpuStat.Idle, cpuNum, "idle")
+		for _, mode := range configStruct.Collectors.CPU.Modes {
+			value, _ := cpuModeValue(cpuStat, mode)
+			ch <- prometheus.MustNewConstMetric(c.cpu, prometheus.CounterValue, value, cpuNum, mode)
+		}
 	}
 	return nil
 }
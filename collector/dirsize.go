@@ -0,0 +1,395 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	directory = "directory"
+	// 默认遍历间隔、单次遍历超时和每秒最多stat的文件数
+	defDirInterval        = 5 * time.Minute
+	defDirTimeout         = time.Minute
+	defDirFilesPerSecond  = 5000
+	dirThrottleBatchFiles = 100
+)
+
+// DirInfo 对应directories下的配置，描述需要统计大小的存档、日志目录
+type DirInfo struct {
+	Path string `yaml:"path"`
+	// MaxDepth 最大遍历深度，目录下的直接文件深度为1，0为不限制
+	MaxDepth int `yaml:"max_depth,omitempty"`
+	// Timeout 单次遍历的超时时间，不包括files_per_second限速等待的时间，超时后保留上一次完整遍历的结果
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Interval 后台遍历的间隔
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// FilesPerSecond 每秒最多stat的文件数，降低对磁盘IO的影响
+	FilesPerSecond int `yaml:"files_per_second,omitempty"`
+}
+
+func (d DirInfo) interval() time.Duration {
+	if d.Interval <= 0 {
+		return defDirInterval
+	}
+	return d.Interval
+}
+
+func (d DirInfo) timeout() time.Duration {
+	if d.Timeout <= 0 {
+		return defDirTimeout
+	}
+	return d.Timeout
+}
+
+func (d DirInfo) filesPerSecond() int {
+	if d.FilesPerSecond <= 0 {
+		return defDirFilesPerSecond
+	}
+	return d.FilesPerSecond
+}
+
+// dirStats 一次遍历的结果
+type dirStats struct {
+	bytes, files   float64
+	oldest, newest time.Time
+	duration       time.Duration
+	success        bool
+}
+
+// dirWalker 在后台周期性遍历一个目录，并缓存最近一次完整遍历的结果
+type dirWalker struct {
+	cfg    DirInfo
+	logger log.Logger
+	stop   chan struct{}
+
+	mu       sync.Mutex
+	stats    *dirStats
+	lastWalk *dirStats
+	// walking 遍历的goroutine还没有结束，卡在挂起的挂载点上时可能超过timeout
+	walking bool
+	// slept 本次遍历中限速等待的总时间，不计入超时
+	slept time.Duration
+}
+
+// walkResult 后台遍历goroutine的结果
+type walkResult struct {
+	stats dirStats
+	err   error
+}
+
+var (
+	dirWalkers = struct {
+		sync.Mutex
+		m map[string]*dirWalker
+	}{m: map[string]*dirWalker{}}
+	// 同一时刻只遍历一个目录，避免多个目录同时遍历打满磁盘IO；
+	// 遍历卡住超过timeout时会提前释放，不影响其他目录
+	dirWalkLock sync.Mutex
+
+	errDirWalkTimeout = errors.New("directory walk timed out")
+	errDirWalkStopped = errors.New("directory walk stopped")
+)
+
+// dirDescs 目录统计的指标描述，namespace来自配置
+type dirDescs struct {
+	size         *prometheus.Desc
+	files        *prometheus.Desc
+	oldest       *prometheus.Desc
+	newest       *prometheus.Desc
+	walkDuration *prometheus.Desc
+	walkSuccess  *prometheus.Desc
+}
+
+func newDirDescs(ns string) dirDescs {
+	return dirDescs{
+		size: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, directory, "size_bytes"),
+			"Total size of regular files in the directory.",
+			[]string{"path"}, nil,
+		),
+		files: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, directory, "files"),
+			"Number of regular files in the directory.",
+			[]string{"path"}, nil,
+		),
+		oldest: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, directory, "oldest_mtime_seconds"),
+			"Modification time of the oldest file in the directory, in unixtime.",
+			[]string{"path"}, nil,
+		),
+		newest: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, directory, "newest_mtime_seconds"),
+			"Modification time of the newest file in the directory, in unixtime.",
+			[]string{"path"}, nil,
+		),
+		walkDuration: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, directory, "walk_duration_seconds"),
+			"Duration of the last background walk of the directory.",
+			[]string{"path"}, nil,
+		),
+		walkSuccess: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, directory, "walk_success"),
+			"Whether the last background walk of the directory finished before its timeout (1 for success, 0 for failure).",
+			[]string{"path"}, nil,
+		),
+	}
+}
+
+// ScrapeDirectoryInfo collects size, file count and mtimes of configured directories
+type ScrapeDirectoryInfo struct {
+	Config *SafeConfig
+}
+
+// Name method of Scraper
+func (ScrapeDirectoryInfo) Name() string {
+	return directory + "_size"
+}
+
+// Help method of Scraper
+func (ScrapeDirectoryInfo) Help() string {
+	return "Scrape total size, file count and oldest/newest mtime of configured directories, walked in the background"
+}
+
+// Version method of Scraper
+func (ScrapeDirectoryInfo) Version() float64 {
+	return 1.0
+}
+
+// Scrape method of Scraper
+// 遍历在后台进行，Scrape只返回缓存的结果
+func (s ScrapeDirectoryInfo) Scrape(ctx context.Context, ch chan<- prometheus.Metric, logger log.Logger) error {
+	configStruct := s.Config.Get()
+	descs := newDirDescs(configStruct.Namespace)
+	walkers := syncDirWalkers(configStruct.Directories, logger)
+	for _, w := range walkers {
+		w.mu.Lock()
+		stats, last := w.stats, w.lastWalk
+		w.mu.Unlock()
+		if last == nil {
+			// 第一次遍历还没有结束
+			continue
+		}
+		path := w.cfg.Path
+		if stats != nil {
+			ch <- prometheus.MustNewConstMetric(descs.size, prometheus.GaugeValue, stats.bytes, path)
+			ch <- prometheus.MustNewConstMetric(descs.files, prometheus.GaugeValue, stats.files, path)
+			if stats.files > 0 {
+				ch <- prometheus.MustNewConstMetric(descs.oldest, prometheus.GaugeValue, float64(stats.oldest.Unix()), path)
+				ch <- prometheus.MustNewConstMetric(descs.newest, prometheus.GaugeValue, float64(stats.newest.Unix()), path)
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(descs.walkDuration, prometheus.GaugeValue, last.duration.Seconds(), path)
+		success := 0.0
+		if last.success {
+			success = 1
+		}
+		ch <- prometheus.MustNewConstMetric(descs.walkSuccess, prometheus.GaugeValue, success, path)
+	}
+	return nil
+}
+
+// syncDirWalkers 按照配置启动新的walker，停止已经删除或修改过的walker
+func syncDirWalkers(dirs []DirInfo, logger log.Logger) []*dirWalker {
+	dirWalkers.Lock()
+	defer dirWalkers.Unlock()
+	wanted := make(map[string]bool, len(dirs))
+	result := make([]*dirWalker, 0, len(dirs))
+	for _, d := range dirs {
+		d.Path = filepath.Clean(d.Path)
+		if wanted[d.Path] {
+			continue
+		}
+		wanted[d.Path] = true
+		w, ok := dirWalkers.m[d.Path]
+		if ok && w.cfg != d {
+			close(w.stop)
+			ok = false
+		}
+		if !ok {
+			w = &dirWalker{
+				cfg:    d,
+				logger: log.With(logger, "path", d.Path),
+				stop:   make(chan struct{}),
+			}
+			dirWalkers.m[d.Path] = w
+			go w.run()
+		}
+		result = append(result, w)
+	}
+	for path, w := range dirWalkers.m {
+		if !wanted[path] {
+			close(w.stop)
+			delete(dirWalkers.m, path)
+		}
+	}
+	return result
+}
+
+// run 周期性遍历目录，直到walker被停止
+func (w *dirWalker) run() {
+	ticker := time.NewTicker(w.cfg.interval())
+	defer ticker.Stop()
+	for {
+		w.walkOnce()
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *dirWalker) walkOnce() {
+	w.mu.Lock()
+	walking := w.walking
+	w.mu.Unlock()
+	if walking {
+		// 上一次遍历还卡在stat等系统调用上，等它结束后再开始新的遍历
+		level.Warn(w.logger).Log("msg", "Previous directory walk is still running, skipping")
+		return
+	}
+	dirWalkLock.Lock()
+	defer dirWalkLock.Unlock()
+	select {
+	case <-w.stop:
+		return
+	default:
+	}
+	w.mu.Lock()
+	w.walking = true
+	w.slept = 0
+	w.mu.Unlock()
+	done := make(chan walkResult, 1)
+	go func() {
+		stats, err := w.walk()
+		w.mu.Lock()
+		w.walking = false
+		w.mu.Unlock()
+		done <- walkResult{stats, err}
+	}()
+	stats, err := w.wait(done)
+	if err == errDirWalkStopped {
+		return
+	}
+	if err != nil {
+		level.Error(w.logger).Log("msg", "Failed to walk directory", "err", err)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lastWalk = &stats
+	// 超时或出错时保留上一次完整遍历的结果，避免统计值突然变小
+	if stats.success {
+		w.stats = &stats
+	}
+}
+
+// wait 等待遍历结束。walk只在文件之间检查超时，stat卡在挂起的挂载点上时，
+// 除去限速等待后的时间超过timeout就不再等待，释放dirWalkLock让其他目录继续遍历
+func (w *dirWalker) wait(done <-chan walkResult) (dirStats, error) {
+	start := time.Now()
+	timeout := w.cfg.timeout()
+	for {
+		w.mu.Lock()
+		remaining := timeout - (time.Since(start) - w.slept)
+		w.mu.Unlock()
+		if remaining <= 0 {
+			return dirStats{duration: time.Since(start)}, errDirWalkTimeout
+		}
+		timer := time.NewTimer(remaining)
+		select {
+		case r := <-done:
+			timer.Stop()
+			return r.stats, r.err
+		case <-w.stop:
+			timer.Stop()
+			return dirStats{}, errDirWalkStopped
+		case <-timer.C:
+		}
+	}
+}
+
+// walk 遍历目录并统计普通文件，按照files_per_second限速
+func (w *dirWalker) walk() (dirStats, error) {
+	var stats dirStats
+	root := w.cfg.Path
+	start := time.Now()
+	timeout := w.cfg.timeout()
+	rate := float64(w.cfg.filesPerSecond())
+	var visited int
+	var slept time.Duration
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			// 权限不足或者文件已被删除，跳过
+			return nil
+		}
+		visited++
+		if visited%dirThrottleBatchFiles == 0 {
+			select {
+			case <-w.stop:
+				return errDirWalkStopped
+			default:
+			}
+			if time.Since(start)-slept > timeout {
+				return errDirWalkTimeout
+			}
+			if ahead := time.Duration(float64(visited)/rate*float64(time.Second)) - time.Since(start); ahead > 0 {
+				// 先记录等待时间，wait在等待期间也不会把它算作超时
+				slept += ahead
+				w.mu.Lock()
+				w.slept = slept
+				w.mu.Unlock()
+				timer := time.NewTimer(ahead)
+				select {
+				case <-w.stop:
+					timer.Stop()
+					return errDirWalkStopped
+				case <-timer.C:
+				}
+			}
+		}
+		if info.IsDir() {
+			if w.cfg.MaxDepth > 0 && path != root && dirDepth(root, path) >= w.cfg.MaxDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		mtime := info.ModTime()
+		if stats.files == 0 || mtime.Before(stats.oldest) {
+			stats.oldest = mtime
+		}
+		if stats.files == 0 || mtime.After(stats.newest) {
+			stats.newest = mtime
+		}
+		stats.files++
+		stats.bytes += float64(info.Size())
+		return nil
+	})
+	stats.duration = time.Since(start)
+	stats.success = err == nil
+	return stats, err
+}
+
+// dirDepth 返回path相对root的深度，root的直接子项深度为1
+func dirDepth(root, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+var _ Scraper = ScrapeDirectoryInfo{}
@@ -0,0 +1,253 @@
+package collector
+
+import (
+	"fmt"
+	"github.com/prometheus/procfs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 默认跳过这些目录下的系统进程
+var systemExecutableDirs = []string{"/bin/", "/sbin/", "/usr/bin/", "/usr/sbin/", "/usr/lib/", "/lib/", "/usr/libexec/"}
+
+var (
+	// 参数中可以作为进程名后缀的部分，例如 -server.id=10201 中的10201
+	discoverSuffixRE = regexp.MustCompile(`[A-Za-z0-9_.-]+$`)
+	discoverNameRE   = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+)
+
+// 太长的参数不适合作为区分进程的字段
+const maxDiscoverTokenLen = 64
+
+// DiscoveredProcess 一个建议的进程配置，以及当前匹配到的进程
+type DiscoveredProcess struct {
+	Info
+	PIDs     []int
+	Cmdlines []string
+	// Overlaps 同时被这个配置匹配到的其他进程
+	Overlaps []int
+}
+
+type discoverProc struct {
+	procInfo
+	exe  string
+	args []string
+}
+
+// DiscoverProcesses 扫描/proc，按照可执行文件和区分进程的cmdline参数分组，返回建议的进程配置
+// all为false时跳过系统目录下的可执行文件
+func DiscoverProcesses(all bool) ([]DiscoveredProcess, error) {
+	procs, err := listDiscoverProcs(all)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string][]discoverProc)
+	for _, p := range procs {
+		groups[p.exe] = append(groups[p.exe], p)
+	}
+	exes := make([]string, 0, len(groups))
+	for exe := range groups {
+		exes = append(exes, exe)
+	}
+	sort.Strings(exes)
+
+	var result []DiscoveredProcess
+	usedNames := make(map[string]bool)
+	for _, exe := range exes {
+		result = append(result, discoverGroup(exe, groups[exe], usedNames)...)
+	}
+
+	matchable := make([]procInfo, len(procs))
+	for i, p := range procs {
+		matchable[i] = p.procInfo
+	}
+	for i := range result {
+		d := &result[i]
+		if err := d.Info.validate(); err != nil {
+			return nil, fmt.Errorf("generated entry %q is invalid: %w", d.Name, err)
+		}
+		own := make(map[int]bool, len(d.PIDs))
+		for _, pid := range d.PIDs {
+			own[pid] = true
+		}
+		for _, p := range matchProcesses(d.Info, matchable) {
+			if !own[p.pid] {
+				d.Overlaps = append(d.Overlaps, p.pid)
+			}
+		}
+	}
+	return result, nil
+}
+
+// discoverGroup 为同一个可执行文件的进程生成配置，多个进程时用只出现在一个进程中的参数区分
+func discoverGroup(exe string, procs []discoverProc, usedNames map[string]bool) []DiscoveredProcess {
+	base := filepath.Base(exe)
+	exePattern := argv0Pattern(base, procs)
+	if len(procs) > 1 {
+		counts := make(map[string]int)
+		for _, p := range procs {
+			for _, token := range uniqueTokens(p.args) {
+				counts[token]++
+			}
+		}
+		var result []DiscoveredProcess
+		var rest []discoverProc
+		for _, p := range procs {
+			token := distinguishingToken(p.args, counts)
+			if token == "" {
+				rest = append(rest, p)
+				continue
+			}
+			d := newDiscovered(uniqueName(discoverName(base, token), usedNames), []string{regexp.QuoteMeta(token), exePattern})
+			d.add(p)
+			result = append(result, d)
+		}
+		if len(rest) == 0 {
+			return result
+		}
+		procs = rest
+		exePattern = argv0Pattern(base, procs)
+		if len(result) > 0 {
+			// 剩下的进程无法区分，合并为一个配置
+			base = base + "_other"
+		}
+		d := newDiscovered(uniqueName(base, usedNames), []string{exePattern})
+		for _, p := range procs {
+			d.add(p)
+		}
+		return append(result, d)
+	}
+	d := newDiscovered(uniqueName(base, usedNames), []string{exePattern})
+	d.add(procs[0])
+	return []DiscoveredProcess{d}
+}
+
+// argv0Pattern 匹配进程的argv[0]，cmdline中的argv[0]不一定是exe的完整路径
+func argv0Pattern(base string, procs []discoverProc) string {
+	argv0 := procs[0].args[0]
+	for _, p := range procs[1:] {
+		if p.args[0] != argv0 {
+			return regexp.QuoteMeta(base)
+		}
+	}
+	return regexp.QuoteMeta(argv0)
+}
+
+func newDiscovered(name string, cmdline []string) DiscoveredProcess {
+	return DiscoveredProcess{Info: Info{Name: name, Cmdline: cmdline}}
+}
+
+func (d *DiscoveredProcess) add(p discoverProc) {
+	d.PIDs = append(d.PIDs, p.pid)
+	d.Cmdlines = append(d.Cmdlines, p.cmdline)
+}
+
+// uniqueTokens 返回去重后的参数，不包括argv[0]
+func uniqueTokens(args []string) []string {
+	seen := make(map[string]bool)
+	var tokens []string
+	for _, a := range args[1:] {
+		if a == "" || len(a) > maxDiscoverTokenLen || seen[a] {
+			continue
+		}
+		seen[a] = true
+		tokens = append(tokens, a)
+	}
+	return tokens
+}
+
+// distinguishingToken 优先选择只出现在这个进程中且包含数字的参数(通常是区服id)
+func distinguishingToken(args []string, counts map[string]int) string {
+	var first string
+	for _, token := range uniqueTokens(args) {
+		if counts[token] != 1 {
+			continue
+		}
+		if strings.ContainsAny(token, "0123456789") {
+			return token
+		}
+		if first == "" {
+			first = token
+		}
+	}
+	return first
+}
+
+// discoverName 由可执行文件名和区分参数生成进程名，参数本身包含可执行文件名时直接使用参数
+func discoverName(base, token string) string {
+	suffix := discoverSuffixRE.FindString(token)
+	suffix = strings.Trim(discoverNameRE.ReplaceAllString(suffix, "_"), "_.-")
+	if suffix == "" {
+		return base
+	}
+	if strings.HasPrefix(suffix, base) {
+		return suffix
+	}
+	return base + "_" + suffix
+}
+
+func uniqueName(name string, used map[string]bool) string {
+	candidate := name
+	for i := 2; used[candidate]; i++ {
+		candidate = fmt.Sprintf("%s_%d", name, i)
+	}
+	used[candidate] = true
+	return candidate
+}
+
+// listDiscoverProcs 读取所有用户进程的可执行文件和参数
+func listDiscoverProcs(all bool) ([]discoverProc, error) {
+	fs, err := procfs.NewFS(procPath)
+	if err != nil {
+		return nil, err
+	}
+	procs, err := fs.AllProcs()
+	if err != nil {
+		return nil, err
+	}
+	self := os.Getpid()
+	var result []discoverProc
+	for _, p := range procs {
+		if p.PID == self {
+			continue
+		}
+		args, err := p.CmdLine()
+		if err != nil || len(args) == 0 {
+			continue
+		}
+		stat, err := p.Stat()
+		if err != nil {
+			continue
+		}
+		exe, err := p.Executable()
+		if err != nil || exe == "" {
+			// 没有权限读取exe链接时使用argv[0]
+			exe = args[0]
+		}
+		if !all && isSystemExecutable(exe) {
+			continue
+		}
+		result = append(result, discoverProc{
+			procInfo: procInfo{
+				pid:       p.PID,
+				cmdline:   strings.Join(args, " "),
+				startTime: stat.Starttime,
+			},
+			exe:  exe,
+			args: args,
+		})
+	}
+	return result, nil
+}
+
+func isSystemExecutable(exe string) bool {
+	for _, dir := range systemExecutableDirs {
+		if strings.HasPrefix(exe, dir) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,10 +2,13 @@ package collector
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,6 +26,16 @@ var (
 		"Collector time duration",
 		[]string{"collector"}, nil,
 	)
+	scrapeTimeoutDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "collector_timeout"),
+		"Whether the collector timed out and was abandoned in this scrape (1 for timeout, 0 for in time).",
+		[]string{"collector"}, nil,
+	)
+	scrapeSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, exporter, "collector_success"),
+		"Whether the collector succeeded in this scrape (1 for success, 0 for error or timeout).",
+		[]string{"collector"}, nil,
+	)
 )
 
 // Exporter collects game metrics. It implements prometheus.Collector.
@@ -31,15 +44,24 @@ type Exporter struct {
 	logger   log.Logger
 	scrapers []Scraper
 	metrics  Metrics
+	// 配置中的静态标签，没有配置时为nil
+	labeler *labeler
+	// 各collector的超时时间和后台执行间隔
+	collectors CollectorsConfig
+	// 后台执行的collector的缓存结果，为nil时所有collector都在抓取时执行
+	background *Background
 }
 
 // New returns a new game exporter for
-func New(ctx context.Context, metrics Metrics, scrapers []Scraper, logger log.Logger) *Exporter {
+func New(ctx context.Context, metrics Metrics, scrapers []Scraper, config *MyConfig, logger log.Logger) *Exporter {
 	return &Exporter{
 		ctx:      ctx,
 		logger:   logger,
 		scrapers: scrapers,
 		metrics:  metrics,
+		labeler:  newLabeler(config),
+
+		collectors: config.Collectors,
 	}
 }
 
@@ -53,31 +75,149 @@ func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 
 // Collect implement prometheus.Collector
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	if e.labeler != nil {
+		// 经过一个中间channel给所有指标加上静态标签
+		labeled := make(chan prometheus.Metric)
+		done := make(chan struct{})
+		go func(out chan<- prometheus.Metric) {
+			for m := range labeled {
+				out <- e.labeler.wrap(m)
+			}
+			close(done)
+		}(ch)
+		defer func() {
+			close(labeled)
+			<-done
+		}()
+		ch = labeled
+	}
 	e.scrape(e.ctx, ch)
 	//ch <- e.metrics.TotalScrapes
 	ch <- e.metrics.Error
 	e.metrics.ScrapeErrors.Collect(ch)
 }
 
-// scrape go func() 执行各个collector的scrape
+// scrape go func() 执行各个collector的scrape，后台执行的collector输出缓存的结果
+// 所有collector结束后更新last_scrape_error
 func (e *Exporter) scrape(ctx context.Context, ch chan<- prometheus.Metric) {
 	var wg sync.WaitGroup
-	defer wg.Wait()
+	var failed int32
 	for _, scraper := range e.scrapers {
+		if e.background != nil {
+			if s, ok := e.background.cached(scraper, e.collectors); ok {
+				if s == nil {
+					continue
+				}
+				for _, m := range s.metrics {
+					ch <- m
+				}
+				ch <- prometheus.MustNewConstMetric(snapshotAgeDesc, prometheus.GaugeValue,
+					time.Since(s.time).Seconds(), "collect."+scraper.Name())
+				if !s.success {
+					atomic.StoreInt32(&failed, 1)
+				}
+				continue
+			}
+		}
 		wg.Add(1)
 		go func(scraper Scraper) {
 			defer wg.Done()
-			label := "collect." + scraper.Name()
-			scrapeTime := time.Now()
-			if err := scraper.Scrape(ch, log.With(e.logger, "scraper", scraper.Name())); err != nil {
-				level.Error(e.logger).Log("msg", "Error from scraper", "scraper", scraper.Name(), "err", err)
-				e.metrics.ScrapeErrors.WithLabelValues(label).Inc()
-				e.metrics.Error.Set(1)
+			if err := e.scrapeOne(ctx, scraper, ch); err != nil {
+				atomic.StoreInt32(&failed, 1)
 			}
-			ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, time.Since(scrapeTime).Seconds(), label)
 		}(scraper)
 	}
+	wg.Wait()
+	e.metrics.Error.Set(float64(atomic.LoadInt32(&failed)))
+}
+
+// errScraperTimeout 超时被放弃的collector返回的错误
+var errScraperTimeout = errors.New("scraper timed out")
+
+// 超时被放弃后仍在运行的scraper，结束前不再启动，避免卡住的scraper(例如失效的NFS挂载)每次抓取都多一个goroutine
+// 正常执行中的scraper不在这里，不同请求可以同时执行同一个scraper
+var abandoned = struct {
+	sync.Mutex
+	// 同一个scraper可能被多个请求同时放弃，记录还没结束的数量
+	m map[string]int
+}{m: map[string]int{}}
+
+// scrapeOne 执行一个scraper，输出耗时、是否超时和是否成功，并记录到状态页
+func (e *Exporter) scrapeOne(ctx context.Context, scraper Scraper, ch chan<- prometheus.Metric) error {
+	name := scraper.Name()
+	label := "collect." + name
+	scrapeTime := time.Now()
+	err := e.runScraper(ctx, scraper, ch)
+	duration := time.Since(scrapeTime)
+	success, timedOut := 1.0, 0.0
+	if err != nil {
+		level.Error(e.logger).Log("msg", "Error from scraper", "scraper", name, "err", err)
+		e.metrics.ScrapeErrors.WithLabelValues(label).Inc()
+		success = 0
+		if errors.Is(err, errScraperTimeout) {
+			timedOut = 1
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), label)
+	ch <- prometheus.MustNewConstMetric(scrapeTimeoutDesc, prometheus.GaugeValue, timedOut, label)
+	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, label)
+	recordStatus(name, scrapeTime, duration, err)
+	return err
+}
+
+// runScraper 在单独的goroutine中执行scraper，超时后不再等待它，已经产生的指标也被丢弃
+// scraper返回错误时仍然输出已经产生的指标，例如一个证书文件读取失败不影响其他证书
+func (e *Exporter) runScraper(ctx context.Context, scraper Scraper, ch chan<- prometheus.Metric) error {
+	name := scraper.Name()
+	if timeout := e.collectors.timeout(name); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	abandoned.Lock()
+	running := abandoned.m[name]
+	abandoned.Unlock()
+	if running > 0 {
+		return fmt.Errorf("%w: still running from a previous scrape", errScraperTimeout)
+	}
 
+	// 每个scraper使用单独的channel，完成后才把指标转发出去
+	scraperCh := make(chan prometheus.Metric)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- scraper.Scrape(ctx, scraperCh, log.With(e.logger, "scraper", name))
+		close(scraperCh)
+	}()
+	var metrics []prometheus.Metric
+	for {
+		select {
+		case m, ok := <-scraperCh:
+			if ok {
+				metrics = append(metrics, m)
+				continue
+			}
+			for _, m := range metrics {
+				ch <- m
+			}
+			return <-errCh
+		case <-ctx.Done():
+			// 在后台读完被放弃的scraper的输出，结束后才允许再次启动
+			abandoned.Lock()
+			abandoned.m[name]++
+			abandoned.Unlock()
+			go func() {
+				for range scraperCh {
+				}
+				abandoned.Lock()
+				abandoned.m[name]--
+				if abandoned.m[name] == 0 {
+					delete(abandoned.m, name)
+				}
+				abandoned.Unlock()
+			}()
+			return fmt.Errorf("%w: %v", errScraperTimeout, ctx.Err())
+		}
+	}
 }
 
 // Metrics represents exporter metrics which values can be carried between http requests.
@@ -107,7 +247,7 @@ func NewMetrics() Metrics {
 			Namespace: namespace,
 			Subsystem: subsystem,
 			Name:      "last_scrape_error",
-			Help:      "Whether the last scrape of metrics from game resulted in an error (1 for error, 0 for success).",
+			Help:      "Whether any collector failed in the last scrape (1 for error, 0 for success).",
 		}),
 	}
 }
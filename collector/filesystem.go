@@ -2,6 +2,7 @@ package collector
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/go-kit/kit/log"
@@ -13,13 +14,88 @@ import (
 	"strings"
 )
 
-// 忽略的挂载点和系统类型
+// 默认忽略的挂载点和系统类型，可以在配置的collectors.filesystem中修改
 const (
 	defIgnoredMountPoints = "^/(dev|proc|sys|var/lib/docker/.+)($|/)"
 	defIgnoredFSTypes     = "^(autofs|binfmt_misc|rootfs|bpf|cgroup2?|configfs|debugfs|devpts|devtmpfs|tmpfs|fusectl|hugetlbfs|iso9660|mqueue|nsfs|overlay|proc|procfs|pstore|rpc_pipefs|securityfs|selinuxfs|squashfs|sysfs|tracefs)$"
 	filesystem            = "linux_filesystem_info"
 )
 
+var (
+	mountPointsIncludeFlag = optionalStringFlag(
+		"collector.filesystem.mount-points-include",
+		"Regexp of mount points to include, overrides collectors.filesystem.mount_points_include in the config file.",
+	)
+	mountPointsExcludeFlag = optionalStringFlag(
+		"collector.filesystem.mount-points-exclude",
+		"Regexp of mount points to exclude, overrides collectors.filesystem.mount_points_exclude in the config file. An empty value disables the exclusion.",
+	)
+	fsTypesIncludeFlag = optionalStringFlag(
+		"collector.filesystem.fs-types-include",
+		"Regexp of filesystem types to include, overrides collectors.filesystem.fs_types_include in the config file.",
+	)
+	fsTypesExcludeFlag = optionalStringFlag(
+		"collector.filesystem.fs-types-exclude",
+		"Regexp of filesystem types to exclude, overrides collectors.filesystem.fs_types_exclude in the config file. An empty value disables the exclusion.",
+	)
+)
+
+// FilesystemConfig 对应collectors下的filesystem，include为空时不过滤；
+// exclude未设置时使用默认值，设置为空字符串时不排除
+type FilesystemConfig struct {
+	MountPointsInclude string  `yaml:"mount_points_include,omitempty"`
+	MountPointsExclude *string `yaml:"mount_points_exclude,omitempty"`
+	FSTypesInclude     string  `yaml:"fs_types_include,omitempty"`
+	FSTypesExclude     *string `yaml:"fs_types_exclude,omitempty"`
+
+	mountPointsInclude, mountPointsExclude *regexp.Regexp
+	fsTypesInclude, fsTypesExclude         *regexp.Regexp
+}
+
+// validate 填充默认值、应用命令行参数并编译正则
+func (f *FilesystemConfig) validate() error {
+	f.MountPointsExclude = orDefault(f.MountPointsExclude, defIgnoredMountPoints)
+	f.FSTypesExclude = orDefault(f.FSTypesExclude, defIgnoredFSTypes)
+	if mountPointsIncludeFlag.value != nil {
+		f.MountPointsInclude = *mountPointsIncludeFlag.value
+	}
+	if mountPointsExcludeFlag.value != nil {
+		f.MountPointsExclude = mountPointsExcludeFlag.value
+	}
+	if fsTypesIncludeFlag.value != nil {
+		f.FSTypesInclude = *fsTypesIncludeFlag.value
+	}
+	if fsTypesExcludeFlag.value != nil {
+		f.FSTypesExclude = fsTypesExcludeFlag.value
+	}
+	var err error
+	if f.mountPointsInclude, err = compileOptional("mount_points_include", f.MountPointsInclude); err != nil {
+		return err
+	}
+	if f.mountPointsExclude, err = compileOptional("mount_points_exclude", *f.MountPointsExclude); err != nil {
+		return err
+	}
+	if f.fsTypesInclude, err = compileOptional("fs_types_include", f.FSTypesInclude); err != nil {
+		return err
+	}
+	f.fsTypesExclude, err = compileOptional("fs_types_exclude", *f.FSTypesExclude)
+	return err
+}
+
+// ignored 挂载点或文件系统类型是否需要忽略
+func (f FilesystemConfig) ignored(labels filesystemLabels) bool {
+	if f.mountPointsInclude != nil && !f.mountPointsInclude.MatchString(labels.mountPoint) {
+		return true
+	}
+	if f.mountPointsExclude != nil && f.mountPointsExclude.MatchString(labels.mountPoint) {
+		return true
+	}
+	if f.fsTypesInclude != nil && !f.fsTypesInclude.MatchString(labels.fsType) {
+		return true
+	}
+	return f.fsTypesExclude != nil && f.fsTypesExclude.MatchString(labels.fsType)
+}
+
 // 标签结构体
 type filesystemLabels struct {
 	device     string
@@ -36,7 +112,9 @@ type filesystemStats struct {
 	//ro, deviceError   float64
 }
 
-type ScrapeFilesystemInfo struct{}
+type ScrapeFilesystemInfo struct {
+	Config *SafeConfig
+}
 
 // Name method of Scraper
 func (ScrapeFilesystemInfo) Name() string {
@@ -54,14 +132,15 @@ func (ScrapeFilesystemInfo) Version() float64 {
 }
 
 // Scrape method of Scraper
-func (ScrapeFilesystemInfo) Scrape(ch chan<- prometheus.Metric, logger log.Logger) error {
-	filesystemstats, err := getStats()
+func (s ScrapeFilesystemInfo) Scrape(ctx context.Context, ch chan<- prometheus.Metric, logger log.Logger) error {
+	configStruct := s.Config.Get()
+	filesystemstats, err := getStats(ctx, configStruct.Collectors.Filesystem)
 	if err != nil {
 		return err
 	}
 	for _, info := range filesystemstats {
 		newdesc := prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, filesystem, "total_free"),
+			prometheus.BuildFQName(configStruct.Namespace, filesystem, "total_free"),
 			"Seconds the filesystem free in each mode.",
 			[]string{"device", "mountpoint"}, nil,
 		)
@@ -116,19 +195,18 @@ func parseFilesystemLabels(r io.Reader) ([]filesystemLabels, error) {
 
 // step3
 // 实际抓取文件系统状态的函数，返回filesystemStats，供Scraper遍历发送chan
-func getStats() ([]filesystemStats, error) {
+// ctx结束后不再statfs剩下的挂载点
+func getStats(ctx context.Context, cfg FilesystemConfig) ([]filesystemStats, error) {
 	mps, err := mountPointDetails()
 	if err != nil {
 		fmt.Println(err.Error())
 	}
 	stats := []filesystemStats{}
 	for _, labels := range mps {
-		if ok, _ := regexp.MatchString(defIgnoredMountPoints, labels.mountPoint); ok {
-			//fmt.Println("已忽略此挂载点", labels.mountPoint)
-			continue
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
 		}
-		if ok, _ := regexp.MatchString(defIgnoredFSTypes, labels.fsType); ok {
-			//fmt.Println("已忽略此类型", labels.fsType)
+		if cfg.ignored(labels) {
 			continue
 		}
 		//fmt.Printf("device:%s, mountpoiont:%s, fstype:%s\n", labels.device, labels.mountPoint, labels.fsType)
@@ -0,0 +1,130 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	fileFreshness = "file_freshness"
+)
+
+// FreshnessInfo 对应file_freshness下的配置，用于检查备份等定期生成的文件
+type FreshnessInfo struct {
+	// Name 标签中的名字，为空时使用glob
+	Name string `yaml:"name,omitempty"`
+	// Glob 文件匹配规则，例如 /data/backup/db_*.sql.gz
+	Glob string `yaml:"glob"`
+}
+
+// freshnessDescs 文件新鲜度的指标描述，namespace来自配置
+type freshnessDescs struct {
+	age     *prometheus.Desc
+	mtime   *prometheus.Desc
+	size    *prometheus.Desc
+	matches *prometheus.Desc
+}
+
+func newFreshnessDescs(ns string) freshnessDescs {
+	return freshnessDescs{
+		age: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, fileFreshness, "newest_age_seconds"),
+			"Age of the newest file matching the glob, based on its mtime.",
+			[]string{"name", "pattern"}, nil,
+		),
+		mtime: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, fileFreshness, "newest_mtime_seconds"),
+			"Modification time of the newest file matching the glob, in unixtime.",
+			[]string{"name", "pattern"}, nil,
+		),
+		size: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, fileFreshness, "newest_size_bytes"),
+			"Size of the newest file matching the glob.",
+			[]string{"name", "pattern"}, nil,
+		),
+		matches: prometheus.NewDesc(
+			prometheus.BuildFQName(ns, fileFreshness, "matches"),
+			"Number of regular files matching the glob.",
+			[]string{"name", "pattern"}, nil,
+		),
+	}
+}
+
+// ScrapeFileFreshness collects age, size and count of the files matching configured globs
+type ScrapeFileFreshness struct {
+	Config *SafeConfig
+}
+
+// Name method of Scraper
+func (ScrapeFileFreshness) Name() string {
+	return fileFreshness
+}
+
+// Help method of Scraper
+func (ScrapeFileFreshness) Help() string {
+	return "Scrape age, size and match count of the newest file matching configured globs, e.g. backups"
+}
+
+// Version method of Scraper
+func (ScrapeFileFreshness) Version() float64 {
+	return 1.0
+}
+
+// Scrape method of Scraper
+func (s ScrapeFileFreshness) Scrape(ctx context.Context, ch chan<- prometheus.Metric, logger log.Logger) error {
+	configStruct := s.Config.Get()
+	descs := newFreshnessDescs(configStruct.Namespace)
+	var lastErr error
+	now := time.Now()
+	for _, v := range configStruct.Freshness {
+		name := v.Name
+		if name == "" {
+			name = v.Glob
+		}
+		newest, matches, err := newestMatch(v.Glob)
+		if err != nil {
+			level.Error(logger).Log("msg", "Failed to check file freshness", "name", name, "err", err)
+			lastErr = err
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(descs.matches, prometheus.GaugeValue, float64(matches), name, v.Glob)
+		if newest == nil {
+			// 没有匹配的文件，只输出matches=0
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(descs.age, prometheus.GaugeValue, now.Sub(newest.ModTime()).Seconds(), name, v.Glob)
+		ch <- prometheus.MustNewConstMetric(descs.mtime, prometheus.GaugeValue, float64(newest.ModTime().Unix()), name, v.Glob)
+		ch <- prometheus.MustNewConstMetric(descs.size, prometheus.GaugeValue, float64(newest.Size()), name, v.Glob)
+	}
+	return lastErr
+}
+
+// newestMatch 返回glob匹配的最新的普通文件和匹配的文件数
+func newestMatch(pattern string) (os.FileInfo, int, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid glob %q: %w", pattern, err)
+	}
+	var newest os.FileInfo
+	var matches int
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil || !info.Mode().IsRegular() {
+			// 文件在glob之后被删除，或者匹配到了目录
+			continue
+		}
+		matches++
+		if newest == nil || info.ModTime().After(newest.ModTime()) {
+			newest = info
+		}
+	}
+	return newest, matches, nil
+}
+
+var _ Scraper = ScrapeFileFreshness{}
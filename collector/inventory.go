@@ -0,0 +1,86 @@
+package collector
+
+import (
+	"github.com/prometheus/procfs"
+	"time"
+)
+
+// ProcessEntry 一个进程配置和当前匹配到的进程，用于/api/v1/processes
+type ProcessEntry struct {
+	Name   string            `json:"name"`
+	Source string            `json:"source"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// Status 配置中的进程都应该在运行，匹配到进程时为up，否则为down
+	Status    string          `json:"status"`
+	Processes []ProcessDetail `json:"processes"`
+}
+
+// ProcessDetail 匹配到的一个进程的启动时间和资源使用
+type ProcessDetail struct {
+	PID                 int       `json:"pid"`
+	Cmdline             string    `json:"cmdline"`
+	StartTime           time.Time `json:"start_time"`
+	CPUSeconds          float64   `json:"cpu_seconds"`
+	ResidentMemoryBytes int       `json:"resident_memory_bytes"`
+	VirtualMemoryBytes  uint      `json:"virtual_memory_bytes"`
+	Threads             int       `json:"threads"`
+}
+
+// ProcessInventory 返回每个进程配置当前匹配到的进程，顺序和配置中相同
+func ProcessInventory(c *MyConfig) ([]ProcessEntry, error) {
+	fs, err := procfs.NewFS(procPath)
+	if err != nil {
+		return nil, err
+	}
+	procs, err := listProcesses()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]ProcessEntry, 0, len(c.Processnames))
+	for _, v := range c.Processnames {
+		entry := ProcessEntry{
+			Name:      v.Name,
+			Source:    v.source,
+			Labels:    v.Labels,
+			Status:    "down",
+			Processes: []ProcessDetail{},
+		}
+		for _, p := range matchProcesses(v, procs) {
+			detail, ok := processDetail(fs, p)
+			if !ok {
+				// 列出进程后已经退出
+				continue
+			}
+			entry.Processes = append(entry.Processes, detail)
+		}
+		if len(entry.Processes) > 0 {
+			entry.Status = "up"
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+func processDetail(fs procfs.FS, p procInfo) (ProcessDetail, bool) {
+	proc, err := fs.Proc(p.pid)
+	if err != nil {
+		return ProcessDetail{}, false
+	}
+	stat, err := proc.Stat()
+	if err != nil || stat.Starttime != p.startTime {
+		return ProcessDetail{}, false
+	}
+	start, err := stat.StartTime()
+	if err != nil {
+		return ProcessDetail{}, false
+	}
+	return ProcessDetail{
+		PID:                 p.pid,
+		Cmdline:             p.cmdline,
+		StartTime:           time.Unix(0, int64(start*float64(time.Second))),
+		CPUSeconds:          stat.CPUTime(),
+		ResidentMemoryBytes: stat.ResidentMemory(),
+		VirtualMemoryBytes:  stat.VirtualMemory(),
+		Threads:             stat.NumThreads,
+	}, true
+}
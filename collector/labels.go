@@ -0,0 +1,139 @@
+package collector
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"sort"
+	"strings"
+)
+
+// reservedLabelNames 各collector已经使用的标签，静态标签不能和它们重名
+var reservedLabelNames = map[string]bool{
+	"collector":  true,
+	"procname":   true,
+	"version":    true,
+	"commit":     true,
+	"cpu":        true,
+	"mode":       true,
+	"device":     true,
+	"mountpoint": true,
+	"item":       true,
+	"path":       true,
+	"name":       true,
+	"pattern":    true,
+	"serial":     true,
+	"subject":    true,
+	"issuer":     true,
+	"sans":       true,
+}
+
+// validateLabels 检查静态标签名是否合法，是否和collector的标签或者其他静态标签重名
+func validateLabels(labels map[string]string, others map[string]string) error {
+	for name := range labels {
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, model.ReservedLabelPrefix) {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+		if reservedLabelNames[name] {
+			return fmt.Errorf("label %q collides with a label used by the collectors", name)
+		}
+		if _, ok := others[name]; ok {
+			return fmt.Errorf("label %q is already set in the global labels", name)
+		}
+	}
+	return nil
+}
+
+// labeler 给exporter输出的所有指标加上全局标签，给带procname标签的指标加上对应进程配置的标签
+type labeler struct {
+	global []*dto.LabelPair
+	// 进程配置中的标签，key为procname；所有进程使用相同的标签名，没有设置的值为空
+	entries map[string][]*dto.LabelPair
+}
+
+// newLabeler 没有配置任何静态标签时返回nil
+func newLabeler(c *MyConfig) *labeler {
+	names := make(map[string]bool)
+	for _, v := range c.Processnames {
+		for name := range v.Labels {
+			names[name] = true
+		}
+	}
+	if len(c.Labels) == 0 && len(names) == 0 {
+		return nil
+	}
+	l := &labeler{
+		global:  labelPairs(c.Labels),
+		entries: make(map[string][]*dto.LabelPair, len(c.Processnames)),
+	}
+	if len(names) > 0 {
+		for _, v := range c.Processnames {
+			values := make(map[string]string, len(names))
+			for name := range names {
+				values[name] = v.Labels[name]
+			}
+			l.entries[v.Name] = labelPairs(values)
+		}
+	}
+	return l
+}
+
+func labelPairs(labels map[string]string) []*dto.LabelPair {
+	pairs := make([]*dto.LabelPair, 0, len(labels))
+	for name, value := range labels {
+		pairs = append(pairs, &dto.LabelPair{
+			Name:  proto(name),
+			Value: proto(value),
+		})
+	}
+	return pairs
+}
+
+func proto(s string) *string {
+	return &s
+}
+
+// wrap 返回加上静态标签的指标
+func (l *labeler) wrap(m prometheus.Metric) prometheus.Metric {
+	return labeledMetric{Metric: m, labeler: l}
+}
+
+// labeledMetric 在Write时加上静态标签
+// 指标的Desc保持不变，newHandler中的registry不是pedantic的，不会检查Desc中的标签
+type labeledMetric struct {
+	prometheus.Metric
+	labeler *labeler
+}
+
+// Write implement prometheus.Metric
+func (m labeledMetric) Write(out *dto.Metric) error {
+	if err := m.Metric.Write(out); err != nil {
+		return err
+	}
+	existing := make(map[string]bool, len(out.Label))
+	var procname string
+	for _, lp := range out.Label {
+		existing[lp.GetName()] = true
+		if lp.GetName() == "procname" {
+			procname = lp.GetValue()
+		}
+	}
+	add := func(pairs []*dto.LabelPair) {
+		for _, lp := range pairs {
+			// 和指标已有的标签重名时保留指标自己的标签
+			if !existing[lp.GetName()] {
+				existing[lp.GetName()] = true
+				out.Label = append(out.Label, lp)
+			}
+		}
+	}
+	add(m.labeler.global)
+	if procname != "" {
+		add(m.labeler.entries[procname])
+	}
+	sort.Slice(out.Label, func(i, j int) bool {
+		return out.Label[i].GetName() < out.Label[j].GetName()
+	})
+	return nil
+}
@@ -9,7 +9,9 @@ import (
 	"strings"
 )
 
-type ScrapeLoadavgInfo struct{}
+type ScrapeLoadavgInfo struct {
+	Config *SafeConfig
+}
 
 type typedDesc struct {
 	desc      *prometheus.Desc
@@ -36,24 +38,25 @@ func (ScrapeLoadavgInfo) Help() string {
 }
 
 // Scrape method
-func (ScrapeLoadavgInfo) Scrape(ch chan<- prometheus.Metric, logger log.Logger) error {
+func (s ScrapeLoadavgInfo) Scrape(ch chan<- prometheus.Metric, logger log.Logger) error {
+	ns := s.Config.Get().Namespace
 	loadInfo, err := getLoad()
 
 	if err != nil {
 		return err
 	}
 	oneloadDesc := prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, linuxLoadavg, "avg1"),
+		prometheus.BuildFQName(ns, linuxLoadavg, "avg1"),
 		"1m load average",
 		nil, nil,
 	)
 	fiveloadDesc := prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, linuxLoadavg, "avg5"),
+		prometheus.BuildFQName(ns, linuxLoadavg, "avg5"),
 		"5m load average",
 		nil, nil,
 	)
 	fifloadDesc := prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, linuxLoadavg, "avg15"),
+		prometheus.BuildFQName(ns, linuxLoadavg, "avg15"),
 		"15m load average",
 		nil, nil,
 	)
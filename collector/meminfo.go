@@ -18,7 +18,9 @@ var (
 	memoryinfo = "linux_memory_info"
 )
 
-type ScrapeMemoryInfo struct{}
+type ScrapeMemoryInfo struct {
+	Config *SafeConfig
+}
 
 // Name method
 func (ScrapeMemoryInfo) Name() string {
@@ -36,11 +38,12 @@ func (ScrapeMemoryInfo) Version() float64 {
 }
 
 // Scrape method
-func (ScrapeMemoryInfo) Scrape(ch chan<- prometheus.Metric, logger log.Logger) error {
+func (s ScrapeMemoryInfo) Scrape(ch chan<- prometheus.Metric, logger log.Logger) error {
+	ns := s.Config.Get().Namespace
 	memMap := getMemoryInfo(logger)
 	for memkey, memvalue := range memMap {
 		newdesc := prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, memoryinfo, "seconds_total"),
+			prometheus.BuildFQName(ns, memoryinfo, "seconds_total"),
 			"Seconds the memory info",
 			[]string{"item"}, nil,
 		)
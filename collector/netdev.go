@@ -16,14 +16,55 @@ import (
 var (
 	procNetDevInterfaceRE = regexp.MustCompile(`^(.+): *(.+)$`)
 	procNetDevFieldSep    = regexp.MustCompile(` +`)
-	ignoreDevice          = regexp.MustCompile("tap.*|veth.*|br.*|docker.*|virbr*|lo*") // 忽略的设备
-	acceptDevice          = regexp.MustCompile("eh*|ens*")                              // 需要抓取的设备
+
+	deviceIncludeFlag = optionalStringFlag(
+		"collector.netdev.device-include",
+		"Regexp of net devices to include, overrides collectors.netdev.device_include in the config file. An empty value includes all devices.",
+	)
+	deviceExcludeFlag = optionalStringFlag(
+		"collector.netdev.device-exclude",
+		"Regexp of net devices to exclude, overrides collectors.netdev.device_exclude in the config file. An empty value disables the exclusion.",
+	)
+)
+
+// 默认忽略和需要抓取的设备，可以在配置的collectors.netdev中修改
+const (
+	defIgnoredDevices  = "tap.*|veth.*|br.*|docker.*|virbr*|lo*"
+	defAcceptedDevices = "eh*|ens*"
 )
 
+// NetdevConfig 对应collectors下的netdev，未设置时使用默认值，设置为空字符串时不过滤
+type NetdevConfig struct {
+	DeviceInclude *string `yaml:"device_include,omitempty"`
+	DeviceExclude *string `yaml:"device_exclude,omitempty"`
+
+	deviceInclude, deviceExclude *regexp.Regexp
+}
+
+// validate 填充默认值、应用命令行参数并编译正则
+func (n *NetdevConfig) validate() error {
+	n.DeviceInclude = orDefault(n.DeviceInclude, defAcceptedDevices)
+	n.DeviceExclude = orDefault(n.DeviceExclude, defIgnoredDevices)
+	if deviceIncludeFlag.value != nil {
+		n.DeviceInclude = deviceIncludeFlag.value
+	}
+	if deviceExcludeFlag.value != nil {
+		n.DeviceExclude = deviceExcludeFlag.value
+	}
+	var err error
+	if n.deviceInclude, err = compileOptional("device_include", *n.DeviceInclude); err != nil {
+		return err
+	}
+	n.deviceExclude, err = compileOptional("device_exclude", *n.DeviceExclude)
+	return err
+}
+
 // 网卡状态字典
 type netDevStats map[string]map[string]uint64
 
-type ScrapeNetInfo struct{}
+type ScrapeNetInfo struct {
+	Config *SafeConfig
+}
 
 const (
 	linuxNet = "linux_net_info"
@@ -44,19 +85,21 @@ func (ScrapeNetInfo) Help() string {
 	return "Scrape linux network receive and transmit info"
 }
 
-func (ScrapeNetInfo) Scrape(ch chan<- prometheus.Metric, logger log.Logger) error {
-	netInfo, err := getNetDevStats(ignoreDevice, acceptDevice, logger)
+func (s ScrapeNetInfo) Scrape(ch chan<- prometheus.Metric, logger log.Logger) error {
+	configStruct := s.Config.Get()
+	netdev := configStruct.Collectors.Netdev
+	netInfo, err := getNetDevStats(netdev.deviceExclude, netdev.deviceInclude, logger)
 	if err != nil {
 		return err
 	}
 	for devName, netBytes := range netInfo {
 		receiveDesc := prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, linuxNet, "receive_bytes_total"),
+			prometheus.BuildFQName(configStruct.Namespace, linuxNet, "receive_bytes_total"),
 			"Network device statistic receive_bytes",
 			[]string{"device"}, nil,
 		)
 		transmitDesc := prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, linuxNet, "transmit_bytes_total"),
+			prometheus.BuildFQName(configStruct.Namespace, linuxNet, "transmit_bytes_total"),
 			"Network device statistic transmit_bytes",
 			[]string{"device"}, nil,
 		)
@@ -110,7 +153,7 @@ func parseNetDevStats(r io.Reader, ignore *regexp.Regexp, accept *regexp.Regexp,
 		}
 		values := procNetDevFieldSep.Split(strings.TrimLeft(parts[2], " "), -1)
 		if len(values) != headerLength {
-			return nil, fmt.Errorf("msg", "could not get values,invalid line in net/dev：%q", parts[2])
+			return nil, fmt.Errorf("could not get values,invalid line in net/dev：%q", parts[2])
 		}
 		devStats := map[string]uint64{}
 		addStats := func(key, value string) {
@@ -0,0 +1,49 @@
+package collector
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// ParamScraper is a Scraper accepting per-request parameters from the query
+// string of /metrics, e.g. game_linux_process_num.procname=gs10201.
+type ParamScraper interface {
+	Scraper
+	// WithParams returns a copy of the scraper configured by params, the
+	// keys are given without the "<Name()>." prefix.
+	WithParams(params url.Values) (Scraper, error)
+}
+
+// procnameFilter 只采集部分进程配置，nil表示采集所有进程
+type procnameFilter struct {
+	names map[string]bool
+}
+
+// newProcnameFilter 解析procname参数，参数中的进程名必须在当前配置中
+func newProcnameFilter(c *MyConfig, params url.Values) (*procnameFilter, error) {
+	for key := range params {
+		if key != "procname" {
+			return nil, fmt.Errorf("unknown parameter %q", key)
+		}
+	}
+	names := params["procname"]
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]bool, len(c.Processnames))
+	for _, v := range c.Processnames {
+		known[v.Name] = true
+	}
+	f := &procnameFilter{names: make(map[string]bool, len(names))}
+	for _, name := range names {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown procname %q", name)
+		}
+		f.names[name] = true
+	}
+	return f, nil
+}
+
+func (f *procnameFilter) match(name string) bool {
+	return f == nil || f.names[name]
+}
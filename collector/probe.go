@@ -0,0 +1,459 @@
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 支持的prober
+const (
+	proberTCP  = "tcp"
+	proberUDP  = "udp"
+	proberHTTP = "http"
+)
+
+// 读取响应的上限，避免探测大文件时占用太多内存
+const maxProbeBodySize = 1 << 20
+
+// 模块没有timeout、请求也没有带Prometheus抓取超时时使用的超时时间
+const defaultProbeTimeout = 10 * time.Second
+
+// ProbeModule 对应probe_modules下的一个模块，/probe?target=...&module=...使用
+type ProbeModule struct {
+	// Prober tcp、udp或http
+	Prober string `yaml:"prober"`
+	// Timeout 单次探测的超时时间，和Prometheus的抓取超时取较小值
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// AllowedTargets 允许探测的target的正则(完整匹配)，为空时不限制；
+	// 模块带有basic_auth或bearer_token时必须设置，避免凭证被发送到任意target
+	AllowedTargets string    `yaml:"allowed_targets,omitempty"`
+	TCP            TCPProbe  `yaml:"tcp,omitempty"`
+	UDP            UDPProbe  `yaml:"udp,omitempty"`
+	HTTP           HTTPProbe `yaml:"http,omitempty"`
+
+	// 该模块所在的文件
+	source         string
+	allowedTargets *regexp.Regexp
+}
+
+// TCPProbe 连接target(host:port)，可以发送一段数据并检查返回
+type TCPProbe struct {
+	TLS                bool `yaml:"tls,omitempty"`
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify,omitempty"`
+	// Send 连接后发送的数据，可能包含RCON密码，打印配置时显示为<secret>
+	Send Secret `yaml:"send,omitempty"`
+	// SendFile 从文件读取send，和send只能设置一个
+	SendFile string `yaml:"send_file,omitempty"`
+	// Expect 匹配第一次读取到的数据的正则，为空时连接成功即可
+	Expect string `yaml:"expect,omitempty"`
+
+	expect *regexp.Regexp
+}
+
+// UDPProbe 向target(host:port)发送send，等待一个回包
+type UDPProbe struct {
+	Send     Secret `yaml:"send,omitempty"`
+	SendFile string `yaml:"send_file,omitempty"`
+	// Expect 匹配回包的正则，为空时收到回包即可
+	Expect string `yaml:"expect,omitempty"`
+
+	expect *regexp.Regexp
+}
+
+// HTTPProbe 请求target(URL，省略scheme时使用http://)，例如GM接口
+type HTTPProbe struct {
+	Method string `yaml:"method,omitempty"`
+	// Headers和Body 常带有GM接口的token，打印配置时显示为<secret>
+	Headers map[string]Secret `yaml:"headers,omitempty"`
+	Body    Secret            `yaml:"body,omitempty"`
+	// HeadersFile 从文件读取header的值，key为header名，和headers中的同名header只能设置一个
+	HeadersFile map[string]string `yaml:"headers_file,omitempty"`
+	BodyFile    string            `yaml:"body_file,omitempty"`
+	// ValidStatusCodes 默认为2xx
+	ValidStatusCodes   []int  `yaml:"valid_status_codes,omitempty"`
+	FailIfBodyNotMatch string `yaml:"fail_if_body_not_matches_regexp,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+
+	BasicAuth       *BasicAuth `yaml:"basic_auth,omitempty"`
+	BearerToken     Secret     `yaml:"bearer_token,omitempty"`
+	BearerTokenFile string     `yaml:"bearer_token_file,omitempty"`
+
+	bodyRegexp *regexp.Regexp
+}
+
+// BasicAuth HTTP basic auth，password也可以用password_file从文件读取
+type BasicAuth struct {
+	Username     string `yaml:"username"`
+	Password     Secret `yaml:"password,omitempty"`
+	PasswordFile string `yaml:"password_file,omitempty"`
+}
+
+// validate 检查模块配置，编译正则并读取secret文件，baseDir为配置文件所在目录
+func (m *ProbeModule) validate(baseDir string) error {
+	if m.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	var err error
+	if m.AllowedTargets != "" {
+		if m.allowedTargets, err = regexp.Compile("^(?:" + m.AllowedTargets + ")$"); err != nil {
+			return fmt.Errorf("invalid allowed_targets %q: %w", m.AllowedTargets, err)
+		}
+	}
+	switch m.Prober {
+	case proberTCP:
+		if err := resolveSecret("send", &m.TCP.Send, m.TCP.SendFile, baseDir); err != nil {
+			return fmt.Errorf("tcp: %w", err)
+		}
+		m.TCP.expect, err = compileOptional("tcp.expect", m.TCP.Expect)
+	case proberUDP:
+		if err := resolveSecret("send", &m.UDP.Send, m.UDP.SendFile, baseDir); err != nil {
+			return fmt.Errorf("udp: %w", err)
+		}
+		if m.UDP.Send == "" {
+			return errors.New("udp.send or udp.send_file is required")
+		}
+		m.UDP.expect, err = compileOptional("udp.expect", m.UDP.Expect)
+	case proberHTTP:
+		if err = m.HTTP.validate(baseDir); err != nil {
+			return err
+		}
+		if (m.HTTP.BasicAuth != nil || m.HTTP.BearerToken != "") && m.allowedTargets == nil {
+			return errors.New("allowed_targets is required when http.basic_auth or http.bearer_token is set")
+		}
+	default:
+		return fmt.Errorf("unknown prober %q, must be one of tcp, udp or http", m.Prober)
+	}
+	return err
+}
+
+// TargetAllowed target是否在模块的allowed_targets中
+func (m ProbeModule) TargetAllowed(target string) bool {
+	return m.allowedTargets == nil || m.allowedTargets.MatchString(target)
+}
+
+func (h *HTTPProbe) validate(baseDir string) error {
+	if h.Method == "" {
+		h.Method = http.MethodGet
+	}
+	for _, code := range h.ValidStatusCodes {
+		if code < 100 || code > 999 {
+			return fmt.Errorf("invalid status code %d", code)
+		}
+	}
+	var err error
+	if h.bodyRegexp, err = compileOptional("fail_if_body_not_matches_regexp", h.FailIfBodyNotMatch); err != nil {
+		return err
+	}
+	for name, file := range h.HeadersFile {
+		if _, ok := h.Headers[name]; ok {
+			return fmt.Errorf("http: at most one of headers and headers_file can set %q", name)
+		}
+		value, err := readSecretFile(file, baseDir)
+		if err != nil {
+			return fmt.Errorf("http: error reading headers_file %q: %w", name, err)
+		}
+		if h.Headers == nil {
+			h.Headers = make(map[string]Secret)
+		}
+		h.Headers[name] = value
+	}
+	if err := resolveSecret("body", &h.Body, h.BodyFile, baseDir); err != nil {
+		return fmt.Errorf("http: %w", err)
+	}
+	if h.BasicAuth != nil {
+		if err := resolveSecret("password", &h.BasicAuth.Password, h.BasicAuth.PasswordFile, baseDir); err != nil {
+			return fmt.Errorf("http.basic_auth: %w", err)
+		}
+	}
+	if err := resolveSecret("bearer_token", &h.BearerToken, h.BearerTokenFile, baseDir); err != nil {
+		return fmt.Errorf("http: %w", err)
+	}
+	if h.BasicAuth != nil && h.BearerToken != "" {
+		return errors.New("http: at most one of basic_auth and bearer_token can be set")
+	}
+	return nil
+}
+
+// probeMetrics 探测过程中产生的指标，注册在每次请求新建的registry中
+type probeMetrics struct {
+	phase         *prometheus.GaugeVec
+	failedByRegex prometheus.Gauge
+	statusCode    prometheus.Gauge
+	contentLength prometheus.Gauge
+}
+
+func newProbeMetrics(registry *prometheus.Registry, prober string) probeMetrics {
+	m := probeMetrics{
+		phase: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "probe_phase_duration_seconds",
+			Help: "Duration of each phase of the probe: resolve, connect, tls, processing and transfer.",
+		}, []string{"phase"}),
+		failedByRegex: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "probe_failed_due_to_regex",
+			Help: "Indicates if the probe failed because the response did not match the expected regexp.",
+		}),
+		statusCode: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "probe_http_status_code",
+			Help: "Response HTTP status code.",
+		}),
+		contentLength: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "probe_http_content_length",
+			Help: "Length of the HTTP response body.",
+		}),
+	}
+	registry.MustRegister(m.phase, m.failedByRegex)
+	if prober == proberHTTP {
+		registry.MustRegister(m.statusCode, m.contentLength)
+	}
+	return m
+}
+
+// RunProbe 使用模块探测target，指标注册到registry中，返回是否成功
+// 总超时由ctx控制，模块的timeout会进一步缩短超时时间，两者都没有时使用defaultProbeTimeout
+func RunProbe(ctx context.Context, target string, module ProbeModule, registry *prometheus.Registry, logger log.Logger) bool {
+	timeout := module.Timeout
+	if _, ok := ctx.Deadline(); !ok && timeout == 0 {
+		timeout = defaultProbeTimeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	m := newProbeMetrics(registry, module.Prober)
+	var err error
+	switch module.Prober {
+	case proberTCP:
+		err = probeTCP(ctx, target, module.TCP, m)
+	case proberUDP:
+		err = probeUDP(ctx, target, module.UDP, m)
+	case proberHTTP:
+		err = probeHTTP(ctx, target, module.HTTP, m)
+	default:
+		err = fmt.Errorf("unknown prober %q", module.Prober)
+	}
+	if err != nil {
+		level.Debug(logger).Log("msg", "Probe failed", "prober", module.Prober, "err", err)
+		return false
+	}
+	return true
+}
+
+// resolveTarget 单独解析域名，用于记录resolve阶段的时间
+func resolveTarget(ctx context.Context, target string, m probeMetrics) (string, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid target %q, expected host:port: %w", target, err)
+	}
+	start := time.Now()
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	m.phase.WithLabelValues("resolve").Set(time.Since(start).Seconds())
+	if err != nil {
+		return "", err
+	}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("no address found for %s", host)
+	}
+	return net.JoinHostPort(ips[0].String(), port), nil
+}
+
+func probeTCP(ctx context.Context, target string, cfg TCPProbe, m probeMetrics) error {
+	addr, err := resolveTarget(ctx, target, m)
+	if err != nil {
+		return err
+	}
+	var dialer net.Dialer
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	m.phase.WithLabelValues("connect").Set(time.Since(start).Seconds())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	defer watchConn(ctx, conn)()
+	if cfg.TLS {
+		host, _, _ := net.SplitHostPort(target)
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host, InsecureSkipVerify: cfg.InsecureSkipVerify})
+		start = time.Now()
+		err = tlsConn.Handshake()
+		m.phase.WithLabelValues("tls").Set(time.Since(start).Seconds())
+		if err != nil {
+			return err
+		}
+		conn = tlsConn
+	}
+	if cfg.Send == "" && cfg.expect == nil {
+		return nil
+	}
+	start = time.Now()
+	defer func() {
+		m.phase.WithLabelValues("processing").Set(time.Since(start).Seconds())
+	}()
+	if cfg.Send != "" {
+		if _, err := io.WriteString(conn, string(cfg.Send)); err != nil {
+			return err
+		}
+	}
+	if cfg.expect == nil {
+		return nil
+	}
+	return expectReply(conn, cfg.expect, m)
+}
+
+func probeUDP(ctx context.Context, target string, cfg UDPProbe, m probeMetrics) error {
+	addr, err := resolveTarget(ctx, target, m)
+	if err != nil {
+		return err
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	defer watchConn(ctx, conn)()
+	start := time.Now()
+	defer func() {
+		m.phase.WithLabelValues("processing").Set(time.Since(start).Seconds())
+	}()
+	if _, err := io.WriteString(conn, string(cfg.Send)); err != nil {
+		return err
+	}
+	if cfg.expect == nil {
+		buf := make([]byte, 1)
+		_, err := conn.Read(buf)
+		return err
+	}
+	return expectReply(conn, cfg.expect, m)
+}
+
+// watchConn 把ctx的超时设置到连接上，ctx提前结束(例如客户端断开)时让阻塞的读写立即返回，
+// 返回的函数用于停止监听
+func watchConn(ctx context.Context, conn net.Conn) func() {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// expectReply 读取一次返回的数据并用正则匹配
+func expectReply(conn net.Conn, expect *regexp.Regexp, m probeMetrics) error {
+	buf := make([]byte, 64*1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return err
+	}
+	if !expect.Match(buf[:n]) {
+		m.failedByRegex.Set(1)
+		return fmt.Errorf("reply does not match %q", expect.String())
+	}
+	return nil
+}
+
+func probeHTTP(ctx context.Context, target string, cfg HTTPProbe, m probeMetrics) error {
+	if !strings.Contains(target, "://") {
+		target = "http://" + target
+	}
+	req, err := http.NewRequest(cfg.Method, target, strings.NewReader(string(cfg.Body)))
+	if err != nil {
+		return err
+	}
+	for k, v := range cfg.Headers {
+		if strings.EqualFold(k, "Host") {
+			req.Host = string(v)
+			continue
+		}
+		req.Header.Set(k, string(v))
+	}
+	if cfg.BasicAuth != nil {
+		req.SetBasicAuth(cfg.BasicAuth.Username, string(cfg.BasicAuth.Password))
+	}
+	if cfg.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+string(cfg.BearerToken))
+	}
+
+	var dnsStart, connectStart, tlsStart, wroteRequest, firstByte time.Time
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			m.phase.WithLabelValues("resolve").Set(time.Since(dnsStart).Seconds())
+		},
+		ConnectStart: func(string, string) { connectStart = time.Now() },
+		ConnectDone: func(string, string, error) {
+			m.phase.WithLabelValues("connect").Set(time.Since(connectStart).Seconds())
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			m.phase.WithLabelValues("tls").Set(time.Since(tlsStart).Seconds())
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { wroteRequest = time.Now() },
+		GotFirstResponseByte: func() {
+			firstByte = time.Now()
+			m.phase.WithLabelValues("processing").Set(firstByte.Sub(wroteRequest).Seconds())
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(ctx, trace))
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: cfg.InsecureSkipVerify},
+			DisableKeepAlives: true,
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxProbeBodySize))
+	if !firstByte.IsZero() {
+		m.phase.WithLabelValues("transfer").Set(time.Since(firstByte).Seconds())
+	}
+	m.statusCode.Set(float64(resp.StatusCode))
+	m.contentLength.Set(float64(len(body)))
+	if err != nil {
+		return err
+	}
+	if !validStatusCode(resp.StatusCode, cfg.ValidStatusCodes) {
+		return fmt.Errorf("invalid HTTP status code %d", resp.StatusCode)
+	}
+	if cfg.bodyRegexp != nil && !cfg.bodyRegexp.Match(body) {
+		m.failedByRegex.Set(1)
+		return fmt.Errorf("body does not match %q", cfg.FailIfBodyNotMatch)
+	}
+	return nil
+}
+
+func validStatusCode(code int, valid []int) bool {
+	if len(valid) == 0 {
+		return code >= 200 && code < 300
+	}
+	for _, v := range valid {
+		if v == code {
+			return true
+		}
+	}
+	return false
+}
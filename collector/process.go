@@ -1,65 +1,27 @@
 package collector
 
 import (
-	"fmt"
+	"context"
 	"github.com/go-kit/kit/log"
 	"github.com/prometheus/client_golang/prometheus"
-	"gopkg.in/yaml.v2"
-	"io/ioutil"
+	"github.com/prometheus/procfs"
+	"net/url"
 	"os"
-	"os/exec"
-	"strconv"
 	"strings"
 )
 
-// MyConfig config结构体 ，对应yaml的process_name
-type MyConfig struct {
-	Processnames []Info `yaml:"process_names"`
-}
-
-// Info 结构体，对应process_names下的-name和cmdline
-type Info struct {
-	Name    string   `yaml:"name"`
-	Cmdline []string `yaml:"cmdline"`
-}
-
 const (
 	// subsystem
-	gameProcess = "game_linux_process_num"
+	gameProcess  = "game_linux_process_num"
+	linuxProcess = "linux_process"
 )
 
-// GetConfig 解析yaml，返回myconfig结构体指针
-func GetConfig() (*MyConfig, error) {
-	var fileName string
-	for _, para := range os.Args {
-		if strings.HasPrefix(para, "--config.path") {
-			//fmt.Println(para)
-			//fmt.Printf("Type:%T\n",para)
-			fileName = string(strings.Split(para, "=")[1])
-		}
-	}
-	if fileName == "" {
-		fileName = "./gameprocess.yaml"
-	}
-	var myconfig = new(MyConfig)
-	yamlInfo, _ := ioutil.ReadFile(fileName)
-	err := yaml.Unmarshal(yamlInfo, myconfig)
-	return myconfig, err
-}
-
-// 将结构体内cmdline中，涉及到“/”全部添加转义符 “\”
-func modifyString(s []string) []string {
-	// 只限于当cmdline有两个元素的时候，才去替换
-	if len(s) == 2 {
-		for i := 0; i < len(s); i++ {
-			s[i] = strings.Replace(s[i], "/", "\\/", -1)
-		}
-	}
-	return s
-}
-
 // ScrapeGameProcess collects
-type ScrapeGameProcess struct{}
+type ScrapeGameProcess struct {
+	Config *SafeConfig
+	// filter 由procname参数设置，为nil时采集所有进程
+	filter *procnameFilter
+}
 
 // Name of the Scraper Unique
 func (ScrapeGameProcess) Name() string {
@@ -73,32 +35,26 @@ func (ScrapeGameProcess) Version() float64 {
 func (ScrapeGameProcess) Help() string {
 	return "scrape the number of game processes"
 }
-func (ScrapeGameProcess) Scrape(ch chan<- prometheus.Metric, logger log.Logger) error {
-	var cmd string
-	processNumData := make(map[string]int)
-	configStruct, err := GetConfig()
+func (s ScrapeGameProcess) Scrape(ctx context.Context, ch chan<- prometheus.Metric, logger log.Logger) error {
+	configStruct := s.Config.Get()
+	procs, err := listProcesses()
 	if err != nil {
 		return err
 	}
+	desc := prometheus.NewDesc(
+		prometheus.BuildFQName(configStruct.Namespace, linuxProcess, "num"),
+		"number of process in yaml config",
+		[]string{"procname"}, nil,
+	)
+	processNumData := make(map[string]int)
 	for _, v := range configStruct.Processnames {
-
-		if len(v.Cmdline) == 1 {
-			cmd = `ps aux | awk '/` + v.Cmdline[0] + `/ && !/awk/ '|wc -l`
-		} else {
-			newcmdline := modifyString(v.Cmdline)
-			cmd = `ps aux | awk '/` + newcmdline[0] + `/ && /` + newcmdline[1] + `/  && !/awk/ '|wc -l`
-		}
-		result, err := exec.Command("/bin/bash", "-c", cmd).Output()
-		if err != nil {
-			fmt.Println(err.Error())
+		if s.filter.match(v.Name) {
+			processNumData[v.Name] = len(matchProcesses(v, procs))
 		}
-		pronum, _ := strconv.Atoi(strings.TrimSuffix(string(result), "\n"))
-		processNumData[v.Name] = pronum
-
 	}
 	for procName, procNum := range processNumData {
 		ch <- prometheus.MustNewConstMetric(
-			prometheus.NewDesc(gameProcess, "number of process in yaml config", []string{"procname"}, nil),
+			desc,
 			prometheus.GaugeValue,
 			float64(procNum),
 			procName,
@@ -107,4 +63,83 @@ func (ScrapeGameProcess) Scrape(ch chan<- prometheus.Metric, logger log.Logger)
 	return nil
 }
 
-var _ Scraper = ScrapeGameProcess{}
+// WithParams method of ParamScraper, procname limits the processes to scrape
+func (s ScrapeGameProcess) WithParams(params url.Values) (Scraper, error) {
+	f, err := newProcnameFilter(s.Config.Get(), params)
+	if err != nil {
+		return nil, err
+	}
+	s.filter = f
+	return s, nil
+}
+
+var _ ParamScraper = ScrapeGameProcess{}
+
+// procInfo 运行中进程的快照，供需要pid和启动时间的collector使用
+type procInfo struct {
+	pid       int
+	cmdline   string
+	startTime uint64
+}
+
+// listProcesses 遍历/proc，返回除exporter自身外所有可读取cmdline的进程
+func listProcesses() ([]procInfo, error) {
+	fs, err := procfs.NewFS(procPath)
+	if err != nil {
+		return nil, err
+	}
+	procs, err := fs.AllProcs()
+	if err != nil {
+		return nil, err
+	}
+	self := os.Getpid()
+	result := make([]procInfo, 0, len(procs))
+	for _, p := range procs {
+		if p.PID == self {
+			continue
+		}
+		cmdline, err := p.CmdLine()
+		if err != nil || len(cmdline) == 0 {
+			// 进程已退出或者是内核线程
+			continue
+		}
+		stat, err := p.Stat()
+		if err != nil {
+			continue
+		}
+		result = append(result, procInfo{
+			pid:       p.PID,
+			cmdline:   strings.Join(cmdline, " "),
+			startTime: stat.Starttime,
+		})
+	}
+	return result, nil
+}
+
+// matchProcesses 返回cmdline同时匹配info.Cmdline中所有正则的进程
+func matchProcesses(info Info, procs []procInfo) []procInfo {
+	var matched []procInfo
+	for _, p := range procs {
+		if info.matches(p.cmdline) {
+			matched = append(matched, p)
+		}
+	}
+	return matched
+}
+
+// MatchedPIDs 返回每个进程配置当前在/proc中匹配到的pid，key为配置中的name
+func MatchedPIDs(c *MyConfig) (map[string][]int, error) {
+	procs, err := listProcesses()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string][]int, len(c.Processnames))
+	for _, v := range c.Processnames {
+		var pids []int
+		for _, p := range matchProcesses(v, procs) {
+			pids = append(pids, p.pid)
+		}
+		result[v.Name] = pids
+	}
+	return result, nil
+}
@@ -0,0 +1,185 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// relabel的action，和Prometheus的metric_relabel_configs含义相同
+const (
+	relabelReplace   = "replace"
+	relabelKeep      = "keep"
+	relabelDrop      = "drop"
+	relabelLabelDrop = "labeldrop"
+	relabelLabelMap  = "labelmap"
+)
+
+// RelabelConfig 对应metric_relabel_configs下的一条规则，未设置的字段使用Prometheus的默认值
+type RelabelConfig struct {
+	SourceLabels []string `yaml:"source_labels,flow,omitempty"`
+	Separator    string   `yaml:"separator,omitempty"`
+	TargetLabel  string   `yaml:"target_label,omitempty"`
+	Regex        string   `yaml:"regex,omitempty"`
+	Replacement  string   `yaml:"replacement,omitempty"`
+	Action       string   `yaml:"action,omitempty"`
+
+	// regex编译后的正则，和Prometheus一样匹配整个值
+	regexp *regexp.Regexp
+}
+
+// validate 填充默认值并编译正则
+func (r *RelabelConfig) validate() error {
+	if r.Separator == "" {
+		r.Separator = ";"
+	}
+	if r.Regex == "" {
+		r.Regex = "(.*)"
+	}
+	if r.Replacement == "" {
+		r.Replacement = "$1"
+	}
+	if r.Action == "" {
+		r.Action = relabelReplace
+	}
+	switch r.Action {
+	case relabelReplace:
+		if r.TargetLabel == "" {
+			return errors.New("target_label is required for action replace")
+		}
+		if !strings.Contains(r.TargetLabel, "$") && !model.LabelName(r.TargetLabel).IsValid() {
+			return fmt.Errorf("invalid target_label %q", r.TargetLabel)
+		}
+	case relabelKeep, relabelDrop:
+		if len(r.SourceLabels) == 0 {
+			return fmt.Errorf("source_labels is required for action %s", r.Action)
+		}
+	case relabelLabelDrop, relabelLabelMap:
+	default:
+		return fmt.Errorf("unknown action %q", r.Action)
+	}
+	re, err := regexp.Compile("^(?:" + r.Regex + ")$")
+	if err != nil {
+		return fmt.Errorf("invalid regex %q: %w", r.Regex, err)
+	}
+	r.regexp = re
+	return nil
+}
+
+// apply 对一个序列的标签(包括__name__)执行规则，返回false表示丢弃该序列
+func (r *RelabelConfig) apply(labels map[string]string) bool {
+	values := make([]string, len(r.SourceLabels))
+	for i, name := range r.SourceLabels {
+		values[i] = labels[name]
+	}
+	value := strings.Join(values, r.Separator)
+	switch r.Action {
+	case relabelKeep:
+		return r.regexp.MatchString(value)
+	case relabelDrop:
+		return !r.regexp.MatchString(value)
+	case relabelReplace:
+		indexes := r.regexp.FindStringSubmatchIndex(value)
+		if indexes == nil {
+			return true
+		}
+		target := string(r.regexp.ExpandString(nil, r.TargetLabel, value, indexes))
+		if !model.LabelName(target).IsValid() {
+			return true
+		}
+		res := string(r.regexp.ExpandString(nil, r.Replacement, value, indexes))
+		if res == "" {
+			delete(labels, target)
+		} else {
+			labels[target] = res
+		}
+	case relabelLabelDrop:
+		for name := range labels {
+			if name != model.MetricNameLabel && r.regexp.MatchString(name) {
+				delete(labels, name)
+			}
+		}
+	case relabelLabelMap:
+		mapped := make(map[string]string)
+		for name, v := range labels {
+			if r.regexp.MatchString(name) {
+				mapped[r.regexp.ReplaceAllString(name, r.Replacement)] = v
+			}
+		}
+		for name, v := range mapped {
+			labels[name] = v
+		}
+	}
+	return true
+}
+
+// relabelGatherer 对Gather的结果执行metric_relabel_configs
+type relabelGatherer struct {
+	prometheus.Gatherer
+	configs []RelabelConfig
+}
+
+// NewRelabelGatherer 返回执行relabel规则后的Gatherer，没有规则时直接返回g
+func NewRelabelGatherer(g prometheus.Gatherer, configs []RelabelConfig) prometheus.Gatherer {
+	if len(configs) == 0 {
+		return g
+	}
+	return relabelGatherer{Gatherer: g, configs: configs}
+}
+
+// Gather implement prometheus.Gatherer
+func (g relabelGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := g.Gatherer.Gather()
+	// replace可能修改__name__，按新的指标名重新分组
+	families := make(map[string]*dto.MetricFamily)
+	var names []string
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			labels := make(map[string]string, len(m.Label)+1)
+			for _, lp := range m.Label {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			labels[model.MetricNameLabel] = mf.GetName()
+			if !g.relabel(labels) {
+				continue
+			}
+			name := labels[model.MetricNameLabel]
+			delete(labels, model.MetricNameLabel)
+			m.Label = m.Label[:0]
+			for k, v := range labels {
+				m.Label = append(m.Label, &dto.LabelPair{Name: proto(k), Value: proto(v)})
+			}
+			sort.Slice(m.Label, func(i, j int) bool {
+				return m.Label[i].GetName() < m.Label[j].GetName()
+			})
+			out, ok := families[name]
+			if !ok {
+				out = &dto.MetricFamily{Name: proto(name), Help: mf.Help, Type: mf.Type}
+				families[name] = out
+				names = append(names, name)
+			}
+			out.Metric = append(out.Metric, m)
+		}
+	}
+	sort.Strings(names)
+	result := make([]*dto.MetricFamily, 0, len(names))
+	for _, name := range names {
+		result = append(result, families[name])
+	}
+	return result, err
+}
+
+func (g relabelGatherer) relabel(labels map[string]string) bool {
+	for i := range g.configs {
+		if !g.configs[i].apply(labels) {
+			return false
+		}
+	}
+	// 和Prometheus一样，relabel后没有指标名的序列被丢弃
+	return labels[model.MetricNameLabel] != ""
+}
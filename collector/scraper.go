@@ -1,13 +1,40 @@
 package collector
 
 import (
+	"context"
 	"github.com/go-kit/kit/log"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// Scraper is the interface of a collector, Scrape should return when ctx is
+// done. The Exporter stops waiting for a scraper after its timeout.
 type Scraper interface {
 	Name() string
 	Help() string
 	Version() float64
-	Scrape(ch chan<- prometheus.Metric,logger log.Logger) error
+	Scrape(ctx context.Context, ch chan<- prometheus.Metric, logger log.Logger) error
+}
+
+// LegacyScraper is the Scraper interface without context, wrap it with
+// NewLegacyScraper to register it.
+type LegacyScraper interface {
+	Name() string
+	Help() string
+	Version() float64
+	Scrape(ch chan<- prometheus.Metric, logger log.Logger) error
+}
+
+// NewLegacyScraper adapts a LegacyScraper to Scraper. The context is ignored,
+// the Exporter still abandons the scraper when it times out.
+func NewLegacyScraper(s LegacyScraper) Scraper {
+	return legacyScraper{s}
+}
+
+type legacyScraper struct {
+	LegacyScraper
+}
+
+// Scrape method of Scraper
+func (s legacyScraper) Scrape(ctx context.Context, ch chan<- prometheus.Metric, logger log.Logger) error {
+	return s.LegacyScraper.Scrape(ch, logger)
 }
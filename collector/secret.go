@@ -0,0 +1,121 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+const secretToken = "<secret>"
+
+// 只展开${VAR}形式的环境变量，cmdline和regex中的$、relabel的${1}不受影响
+var envVarRE = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Secret 密码、token等敏感配置，打印配置或通过HTTP输出时显示为<secret>
+type Secret string
+
+// MarshalYAML implement yaml.Marshaler
+func (s Secret) MarshalYAML() (interface{}, error) {
+	if s == "" {
+		return "", nil
+	}
+	return secretToken, nil
+}
+
+// MarshalJSON implement json.Marshaler
+func (s Secret) MarshalJSON() ([]byte, error) {
+	if s == "" {
+		return json.Marshal("")
+	}
+	return json.Marshal(secretToken)
+}
+
+// expandEnv 展开配置中所有字符串值(包括列表和map的值)里的${VAR}，环境变量不存在时报错，避免用空密码启动
+// 在yaml解析之后执行，注释中的${VAR}不会展开，值中的#、引号、冒号和换行也不会改变配置的结构
+func expandEnv(c *MyConfig) error {
+	var missing []string
+	expandValue(reflect.ValueOf(c).Elem(), &missing)
+	if len(missing) > 0 {
+		return fmt.Errorf("environment variable not set: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func expandValue(v reflect.Value, missing *[]string) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			expandValue(v.Elem(), missing)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			// 跳过未导出的字段，例如编译后的正则
+			if f := v.Field(i); f.CanSet() {
+				expandValue(f, missing)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			expandValue(v.Index(i), missing)
+		}
+	case reflect.Map:
+		// map的值不能直接修改，展开副本后写回
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(iter.Value().Type()).Elem()
+			elem.Set(iter.Value())
+			expandValue(elem, missing)
+			v.SetMapIndex(iter.Key(), elem)
+		}
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(expandString(v.String(), missing))
+		}
+	}
+}
+
+func expandString(s string, missing *[]string) string {
+	return envVarRE.ReplaceAllStringFunc(s, func(m string) string {
+		name := envVarRE.FindStringSubmatch(m)[1]
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			*missing = append(*missing, name)
+			return m
+		}
+		return v
+	})
+}
+
+// resolveSecret 从xxx_file读取secret，file和secret只能设置一个
+// file为相对路径时相对于配置文件所在目录，文件末尾的换行会被去掉
+func resolveSecret(field string, secret *Secret, file, baseDir string) error {
+	if file == "" {
+		return nil
+	}
+	if *secret != "" {
+		return fmt.Errorf("at most one of %s and %s_file can be set", field, field)
+	}
+	value, err := readSecretFile(file, baseDir)
+	if err != nil {
+		return fmt.Errorf("error reading %s_file: %w", field, err)
+	}
+	*secret = value
+	return nil
+}
+
+// readSecretFile 读取secret文件，去掉末尾的换行
+func readSecretFile(file, baseDir string) (Secret, error) {
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(baseDir, file)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return Secret(strings.TrimRight(string(data), "\r\n")), nil
+}
@@ -0,0 +1,53 @@
+package collector
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// CollectorStatus collector最近一次执行的结果，供状态页使用
+type CollectorStatus struct {
+	Name         string
+	LastScrape   time.Time
+	LastDuration time.Duration
+	LastSuccess  bool
+	// LastError和LastErrorTime 最近一次失败的错误信息和时间，之后成功也会保留
+	LastError     string
+	LastErrorTime time.Time
+}
+
+var statuses = struct {
+	sync.Mutex
+	m map[string]CollectorStatus
+}{m: map[string]CollectorStatus{}}
+
+// recordStatus 记录collector的执行结果
+func recordStatus(name string, start time.Time, duration time.Duration, err error) {
+	statuses.Lock()
+	defer statuses.Unlock()
+	s := statuses.m[name]
+	s.Name = name
+	s.LastScrape = start
+	s.LastDuration = duration
+	s.LastSuccess = err == nil
+	if err != nil {
+		s.LastError = err.Error()
+		s.LastErrorTime = start.Add(duration)
+	}
+	statuses.m[name] = s
+}
+
+// Statuses 返回执行过的所有collector的状态，按名字排序
+func Statuses() []CollectorStatus {
+	statuses.Lock()
+	defer statuses.Unlock()
+	result := make([]CollectorStatus, 0, len(statuses.m))
+	for _, s := range statuses.m {
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"game_exporter/collector"
+	"os"
+	"strings"
+)
+
+const maxCommentLen = 160
+
+// discover prints a proposed gameprocess.yaml built from the running
+// processes for the discover command and returns the exit code.
+func discover(all bool) int {
+	found, err := collector.DiscoverProcesses(all)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error discovering processes: %s\n", err)
+		return 1
+	}
+	fmt.Println("# Generated by game_exporter discover, review the names and cmdline patterns before use.")
+	fmt.Println("process_names:")
+	for _, d := range found {
+		fmt.Printf("  - name: %s\n", yamlQuote(d.Name))
+		fmt.Println("    cmdline:")
+		for _, c := range d.Cmdline {
+			fmt.Printf("    - %s\n", yamlQuote(c))
+		}
+		for i, pid := range d.PIDs {
+			fmt.Printf("    # pid %d: %s\n", pid, commentText(d.Cmdlines[i]))
+		}
+		if len(d.Overlaps) > 0 {
+			fmt.Printf("    # WARNING: also matches pids %v\n", d.Overlaps)
+		}
+	}
+	return 0
+}
+
+// commentText keeps a cmdline on a single, reasonably short comment line.
+func commentText(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > maxCommentLen {
+		s = s[:maxCommentLen] + "..."
+	}
+	return s
+}
+
+// yamlQuote returns s as a single quoted YAML scalar.
+func yamlQuote(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -2,26 +2,39 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"game_exporter/collector"
+	"game_exporter/web"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/prometheus/common/promlog"
 	"github.com/prometheus/common/promlog/flag"
 	"github.com/prometheus/common/version"
 	"gopkg.in/alecthomas/kingpin.v2"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
 var (
-	listenAddress = kingpin.Flag(
+	listenAddresses = kingpin.Flag(
 		"web.listen-address",
-		"Address to listen on for web interface and telemetry.",
-	).Default(":9088").String()
+		"Address to listen on for web interface and telemetry, repeatable. Use unix:///path/to.sock for a Unix socket. Defaults to :9088 when --web.systemd-socket is not set.",
+	).Strings()
+	systemdSocket = kingpin.Flag(
+		"web.systemd-socket",
+		"Also listen on the sockets passed by systemd socket activation (LISTEN_FDS).",
+	).Bool()
 	metricPath = kingpin.Flag(
 		"web.telemetry-path",
 		"Path under which to expose metrics.",
@@ -30,84 +43,181 @@ var (
 		"timeout-offset",
 		"Offset to subtract from timeout in seconds.",
 	).Default("0.25").Float64()
+	webConfig = kingpin.Flag(
+		"web.config.file",
+		"Path to a web config file with TLS and basic auth settings, it is re-read on every request.",
+	).Default("").String()
+	maxConcurrentScrapes = kingpin.Flag(
+		"web.max-concurrent-scrapes",
+		"Maximum number of concurrent on-demand collections, further scrapes wait in a queue until their timeout (0 means no limit). Identical concurrent scrapes always share one collection.",
+	).Default("0").Int()
+	shutdownDelay = kingpin.Flag(
+		"web.shutdown-delay",
+		"Time to keep serving with /-/ready returning 503 after SIGTERM or SIGQUIT, so load balancers stop sending requests. A second signal skips the delay.",
+	).Default("5s").Duration()
+	shutdownTimeout = kingpin.Flag(
+		"web.shutdown-timeout",
+		"Time to wait for in-flight scrapes to finish on SIGTERM or SIGQUIT.",
+	).Default("15s").Duration()
 	configPath = kingpin.Flag(
 		"config.path",
-		"Path to .my.cnf file to read MySQL credentials from.",
-	).Default("./gameporcess.yaml").String()
+		"Path to gameprocess.yaml with the game processes and other collector settings.",
+	).Default("./gameprocess.yaml").String()
+
+	// sc is loaded once at startup and swapped on reload, it is shared by all scrapers
+	sc = collector.NewSafeConfig()
+
+	serveCmd        = kingpin.Command("serve", "Run the exporter.").Default()
+	checkConfigCmd  = kingpin.Command("check-config", "Validate the config file and exit with a non-zero code on problems.")
+	checkConfigLive = checkConfigCmd.Flag(
+		"live",
+		"Also evaluate the process matchers against /proc and print the matching PIDs.",
+	).Bool()
+	checkConfigPrint = checkConfigCmd.Flag(
+		"print",
+		"Print the merged config after validation, secrets are shown as <secret>.",
+	).Bool()
+	discoverCmd = kingpin.Command("discover", "Scan /proc and print a proposed gameprocess.yaml for the running processes.")
+	discoverAll = discoverCmd.Flag(
+		"all",
+		"Also include processes whose executable is in a system directory like /usr/bin.",
+	).Bool()
 )
 
 // scraper list all possible collection methods
 var scrapers = map[collector.Scraper]bool{
-	collector.ScrapeGameProcess{}:    true,
-	collector.ScrapeCpuInfo{}:        true,
-	collector.ScrapeFilesystemInfo{}: true,
-	collector.ScrapeMemoryInfo{}:     true,
-	collector.ScrapeNetInfo{}:        true,
-	collector.ScrapeLoadavgInfo{}:    true,
+	collector.ScrapeGameProcess{Config: sc}:                             true,
+	collector.NewLegacyScraper(collector.ScrapeCpuInfo{Config: sc}):     true,
+	collector.ScrapeFilesystemInfo{Config: sc}:                          true,
+	collector.NewLegacyScraper(collector.ScrapeMemoryInfo{Config: sc}):  true,
+	collector.NewLegacyScraper(collector.ScrapeNetInfo{Config: sc}):     true,
+	collector.NewLegacyScraper(collector.ScrapeLoadavgInfo{Config: sc}): true,
+	collector.ScrapeGameBuildInfo{Config: sc}:                           true,
+	collector.ScrapeDirectoryInfo{Config: sc}:                           true,
+	collector.ScrapeFileFreshness{Config: sc}:                           true,
+	collector.ScrapeCertificateInfo{Config: sc}:                         true,
 }
 
 func init() {
 	prometheus.MustRegister(version.NewCollector("game_exporter"))
 }
 
-func newHandler(metrics collector.Metrics, scrapers []collector.Scraper, logger log.Logger) http.HandlerFunc {
+// scrapeContext uses the request context for cancellation when the connection
+// gets closed, and adds the timeout from the Prometheus header to it.
+func scrapeContext(r *http.Request, logger log.Logger) (context.Context, context.CancelFunc) {
+	ctx := r.Context()
+	v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if v == "" {
+		return context.WithCancel(ctx)
+	}
+	timeoutSeconds, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		level.Error(logger).Log("msg", "Failed to parse timeout from Prometheus header", "err", err)
+		return context.WithCancel(ctx)
+	}
+	if *timeoutOffset >= timeoutSeconds {
+		// Ignore timeout offset if it dosenot leave time to scrape
+		level.Error(logger).Log("msg", "Timeout offset should be lower than prometheus scraope timeout", "offset", *timeoutOffset, "prometheus_scrape")
+	} else {
+		// Subtract timeout offset from timeout
+		timeoutSeconds -= *timeoutOffset
+	}
+	// Create new timeout context with request context as parent
+	return context.WithTimeout(ctx, time.Duration(timeoutSeconds*float64((time.Second))))
+}
+
+func newHandler(bg *collector.Background, scrapers []collector.Scraper, logger log.Logger) http.HandlerFunc {
+	group := newScrapeGroup(*maxConcurrentScrapes)
 	return func(w http.ResponseWriter, r *http.Request) {
-		filteredScrappers := scrapers
-		params := r.URL.Query()["collecto[]"]
-		// Use requst context for cancllation when connection gets closed
-		ctx := r.Context()
-		// if a timeout is configured via the Prometheus header,add it to the context
-		if v := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"); v != "" {
-			timeoutSeconds, err := strconv.ParseFloat(v, 64)
-			if err != nil {
-				level.Error(logger).Log("msg", "Failed to parse timeout from Prometheus header", "err", err)
-			} else {
-				if *timeoutOffset >= timeoutSeconds {
-					// Ignore timeout offset if it dosenot leave time to scrape
-					level.Error(logger).Log("msg", "Timeout offset should be lower than prometheus scraope timeout", "offset", *timeoutOffset, "prometheus_scrape")
-				} else {
-					// Subtract timeout offset from timeout
-					timeoutSeconds -= *timeoutOffset
-				}
-				// Create new timeout context with request context as parent
-				var cancel context.CancelFunc
-				ctx, cancel = context.WithTimeout(ctx, time.Duration(timeoutSeconds*float64((time.Second))))
-				defer cancel()
-				// Overwrite request with timeout context
-				r = r.WithContext(ctx)
-			}
-		}
+		params := r.URL.Query()["collect[]"]
+		ctx, cancel := scrapeContext(r, logger)
+		defer cancel()
+		// Overwrite request with timeout context
+		r = r.WithContext(ctx)
 		level.Debug(logger).Log("msg", "collect[] params", "params", params)
 
-		// Check if we have some collect[] query parameters
-		if len(params) > 0 {
-			filters := make(map[string]bool)
-			for _, param := range params {
-				filters[param] = true
-			}
-			filteredScrappers = nil
-			for _, scraper := range scrapers {
-				if filters[scraper.Name()] {
-					filteredScrappers = append(filteredScrappers, scraper)
-				}
-			}
+		// Apply collect[], exclude[] and per-collector query parameters
+		filteredScrappers, err := filterScrapers(scrapers, r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		registry := prometheus.NewRegistry()
-		registry.MustRegister(collector.New(ctx, metrics, filteredScrappers, logger))
+		// 同时到达的相同请求共享一次采集，超时不同的请求不共享
+		key := r.URL.Query().Encode() + "\x00" + r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+		families, err := group.do(ctx, key, func(ctx context.Context) ([]*dto.MetricFamily, error) {
+			config := sc.Get()
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(bg.New(ctx, filteredScrappers, config))
 
-		gatherers := prometheus.Gatherers{
-			prometheus.DefaultGatherer,
-			registry,
+			gatherers := prometheus.Gatherers{
+				prometheus.DefaultGatherer,
+				collector.NewRelabelGatherer(registry, config.MetricRelabelConfigs),
+			}
+			return gatherers.Gather()
+		})
+		if errors.Is(err, errOverloaded) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
 		}
+		gatherers := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			return families, err
+		})
 		h := promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{})
 		h.ServeHTTP(w, r)
 	}
 }
 
+// filterScrapers keeps the scrapers named in collect[] (all when empty) minus
+// the ones in exclude[], and passes "<collector>.<param>" query parameters to
+// the scrapers implementing collector.ParamScraper.
+func filterScrapers(scrapers []collector.Scraper, query url.Values) ([]collector.Scraper, error) {
+	enabled := make(map[string]bool, len(scrapers))
+	for _, scraper := range scrapers {
+		enabled[scraper.Name()] = true
+	}
+	filters := make(map[string]map[string]bool)
+	for _, key := range []string{"collect[]", "exclude[]"} {
+		filters[key] = make(map[string]bool)
+		for _, name := range query[key] {
+			if !enabled[name] {
+				return nil, fmt.Errorf("unknown or disabled collector %q in %s", name, key)
+			}
+			filters[key][name] = true
+		}
+	}
+	var filtered []collector.Scraper
+	for _, scraper := range scrapers {
+		name := scraper.Name()
+		if (len(filters["collect[]"]) > 0 && !filters["collect[]"][name]) || filters["exclude[]"][name] {
+			continue
+		}
+		params := url.Values{}
+		for key, values := range query {
+			if strings.HasPrefix(key, name+".") {
+				params[strings.TrimPrefix(key, name+".")] = values
+			}
+		}
+		if len(params) > 0 {
+			ps, ok := scraper.(collector.ParamScraper)
+			if !ok {
+				return nil, fmt.Errorf("collector %s does not take parameters", name)
+			}
+			var err error
+			if scraper, err = ps.WithParams(params); err != nil {
+				return nil, fmt.Errorf("collector %s: %w", name, err)
+			}
+		}
+		filtered = append(filtered, scraper)
+	}
+	return filtered, nil
+}
+
 func main() {
 	scraperFlags := map[collector.Scraper]*bool{}
+	names := make([]string, 0, len(scrapers))
 	for scraper, enabledByDefault := range scrapers {
+		names = append(names, scraper.Name())
 		defaultOn := "false"
 		if enabledByDefault {
 			defaultOn = "true"
@@ -120,26 +230,56 @@ func main() {
 
 		scraperFlags[scraper] = f
 	}
+	// collectors.timeouts和collectors.intervals的key只能是这些名称
+	collector.SetCollectorNames(names...)
 	// Parse flags
 	promlogConfig := &promlog.Config{}
 	flag.AddFlags(kingpin.CommandLine, promlogConfig)
 	kingpin.Version(version.Print("game_exporter"))
 	kingpin.HelpFlag.Short('h')
-	kingpin.Parse()
+	command := kingpin.Parse()
+	switch command {
+	case checkConfigCmd.FullCommand():
+		os.Exit(checkConfig(*configPath, *checkConfigLive, *checkConfigPrint))
+	case discoverCmd.FullCommand():
+		os.Exit(discover(*discoverAll))
+	}
 	logger := promlog.New(promlogConfig)
 
-	var landingPage = []byte(`<html>
-<head><title>MySQLd exporter</title></head>
-<body>
-<h1>MySQLd exporter</h1>
-<p><a href='` + *metricPath + `'>Metrics</a></p>
-</body>
-</html>
-`)
-
 	level.Info(logger).Log("msg", "Starting game_exporter", "version", version.Info())
 	level.Info(logger).Log("msg", "Build context", version.BuildContext())
 
+	if err := sc.ReloadConfig(*configPath); err != nil {
+		level.Error(logger).Log("msg", "Error loading config", "err", err)
+		os.Exit(1)
+	}
+	level.Info(logger).Log("msg", "Loaded config file", "file", *configPath)
+
+	// 处理SIGHUP和/-/reload的配置热加载
+	hup := make(chan os.Signal, 1)
+	reloadCh := make(chan chan error)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-hup:
+				if err := sc.ReloadConfig(*configPath); err != nil {
+					level.Error(logger).Log("msg", "Error reloading config", "err", err)
+					continue
+				}
+				level.Info(logger).Log("msg", "Reloaded config file")
+			case rc := <-reloadCh:
+				if err := sc.ReloadConfig(*configPath); err != nil {
+					level.Error(logger).Log("msg", "Error reloading config", "err", err)
+					rc <- err
+				} else {
+					level.Info(logger).Log("msg", "Reloaded config file")
+					rc <- nil
+				}
+			}
+		}
+	}()
+
 	// Register only scrapers enabled by flag.
 	enabledScrapers := []collector.Scraper{}
 	for scraper, enabled := range scraperFlags {
@@ -148,15 +288,75 @@ func main() {
 			enabledScrapers = append(enabledScrapers, scraper)
 		}
 	}
-	handlerFunc := newHandler(collector.NewMetrics(), enabledScrapers, logger)
+	// collectors.interval大于0的collector在后台执行，/metrics输出缓存的结果
+	bg := collector.NewBackground(collector.NewMetrics(), enabledScrapers, sc, logger)
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	go bg.Run(bgCtx)
+	go warmUp(bgCtx, bg, enabledScrapers, logger)
+	handlerFunc := newHandler(bg, enabledScrapers, logger)
 	http.Handle(*metricPath, promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, handlerFunc))
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write(landingPage)
+	http.HandleFunc("/probe", func(w http.ResponseWriter, r *http.Request) {
+		probeHandler(w, r, logger)
+	})
+	http.HandleFunc("/status", statusHandler)
+	http.HandleFunc("/-/healthy", healthyHandler)
+	http.HandleFunc("/-/ready", readyHandler(enabledScrapers))
+	http.HandleFunc("/api/v1/processes", processesHandler)
+	http.HandleFunc("/api/v1/collectors", collectorsHandler(scraperFlags))
+	http.HandleFunc("/-/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			fmt.Fprintf(w, "This endpoint requires a POST request.\n")
+			return
+		}
+		rc := make(chan error)
+		reloadCh <- rc
+		if err := <-rc; err != nil {
+			http.Error(w, fmt.Sprintf("failed to reload config: %s", err), http.StatusInternalServerError)
+		}
 	})
+	http.HandleFunc("/", landingHandler(enabledScrapers))
+
+	addresses := *listenAddresses
+	if len(addresses) == 0 && !*systemdSocket {
+		addresses = []string{":9088"}
+	}
+	listeners, err := web.Listen(addresses, *systemdSocket)
+	if err != nil {
+		level.Error(logger).Log("msg", "Error listening", "err", err)
+		os.Exit(1)
+	}
+	server := &http.Server{}
+	srvErr := make(chan error, 1)
+	go func() {
+		srvErr <- web.Serve(server, listeners, *webConfig, logger)
+	}()
 
-	level.Info(logger).Log("msg", "Listening on address", "address", *listenAddress)
-	if err := http.ListenAndServe(*listenAddress, nil); err != nil {
+	// systemd的ExecStop发送SIGQUIT，停止接收新请求，等待进行中的抓取完成
+	term := make(chan os.Signal, 1)
+	signal.Notify(term, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+	select {
+	case err := <-srvErr:
 		level.Error(logger).Log("msg", "Error starting HTTP server", "err", err)
 		os.Exit(1)
+	case sig := <-term:
+		level.Info(logger).Log("msg", "Received signal, shutting down gracefully", "signal", sig, "delay", *shutdownDelay, "timeout", *shutdownTimeout)
+	}
+	// 先让/-/ready返回503，负载均衡摘掉流量后再停止接收请求
+	atomic.StoreInt32(&shuttingDown, 1)
+	select {
+	case <-time.After(*shutdownDelay):
+	case <-term:
+		level.Info(logger).Log("msg", "Received second signal, skipping the shutdown delay")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	err = server.Shutdown(ctx)
+	stopBackground()
+	if err != nil {
+		level.Error(logger).Log("msg", "In-flight requests did not finish before the shutdown timeout", "err", err)
+		server.Close()
+		os.Exit(1)
 	}
+	level.Info(logger).Log("msg", "Shutdown complete")
 }
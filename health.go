@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"game_exporter/collector"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// 启动时第一次采集的超时时间，超时的collector也算完成
+const warmUpTimeout = 30 * time.Second
+
+var (
+	// ready 所有启用的collector都执行过一次后为1
+	ready int32
+	// shuttingDown 收到SIGTERM或SIGQUIT后为1，/-/ready返回503让负载均衡摘掉流量
+	shuttingDown int32
+)
+
+// healthyHandler /-/healthy，进程在运行并能处理HTTP请求即为健康
+func healthyHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("Healthy.\n"))
+}
+
+// readyHandler /-/ready，配置加载成功并且每个启用的collector都完成过一次采集后返回200
+func readyHandler(scrapers []collector.Scraper) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&shuttingDown) == 1 {
+			http.Error(w, "Shutting down.", http.StatusServiceUnavailable)
+			return
+		}
+		if atomic.LoadInt32(&ready) == 0 {
+			if !collected(scrapers) {
+				http.Error(w, "Waiting for the first collection.", http.StatusServiceUnavailable)
+				return
+			}
+			atomic.StoreInt32(&ready, 1)
+		}
+		w.Write([]byte("Ready.\n"))
+	}
+}
+
+// collected 是否每个collector都已经执行过，包括失败和超时
+func collected(scrapers []collector.Scraper) bool {
+	done := make(map[string]bool)
+	for _, s := range collector.Statuses() {
+		done[s.Name] = true
+	}
+	for _, scraper := range scrapers {
+		if !done[scraper.Name()] {
+			return false
+		}
+	}
+	return true
+}
+
+// warmUp 启动后执行一次所有collector，不需要等到第一次抓取就能ready
+// 后台执行的collector由Background完成第一次采集
+func warmUp(ctx context.Context, bg *collector.Background, scrapers []collector.Scraper, logger log.Logger) {
+	ctx, cancel := context.WithTimeout(ctx, warmUpTimeout)
+	defer cancel()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(bg.New(ctx, scrapers, sc.Get()))
+	if _, err := registry.Gather(); err != nil {
+		level.Error(logger).Log("msg", "Error in the first collection", "err", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"game_exporter/collector"
+	"github.com/prometheus/common/version"
+	"gopkg.in/yaml.v2"
+	"html/template"
+	"net/http"
+	"sort"
+)
+
+var landingTemplate = template.Must(template.New("landing").Parse(`<html>
+<head><title>Game exporter</title></head>
+<body>
+<h1>Game exporter</h1>
+<p>
+<a href="{{.MetricPath}}">Metrics</a> |
+<a href="/status">Status</a> |
+<a href="/api/v1/processes">Processes API</a> |
+<a href="/api/v1/collectors">Collectors API</a>
+</p>
+<h2>Build</h2>
+<table border="1" cellpadding="4">
+<tr><th>Version</th><td>{{.Version}}</td></tr>
+<tr><th>Revision</th><td>{{.Revision}}</td></tr>
+<tr><th>Branch</th><td>{{.Branch}}</td></tr>
+<tr><th>Build user</th><td>{{.BuildUser}}</td></tr>
+<tr><th>Build date</th><td>{{.BuildDate}}</td></tr>
+<tr><th>Go version</th><td>{{.GoVersion}}</td></tr>
+</table>
+<h2>Collectors</h2>
+<table border="1" cellpadding="4">
+<tr><th>Collector</th><th>Help</th><th>Last duration</th><th>Last error</th></tr>
+{{range .Collectors}}<tr>
+<td><a href="{{$.MetricPath}}?collect[]={{.Name}}">{{.Name}}</a></td>
+<td>{{.Help}}</td>
+<td>{{with .Status}}{{.LastDuration}}{{end}}</td>
+<td>{{with .Status}}{{if not .LastSuccess}}{{.LastError}}{{end}}{{end}}</td>
+</tr>
+{{end}}</table>
+<h2>Configuration</h2>
+<p>{{range .ConfigFiles}}{{.}}<br>{{end}}</p>
+<pre>{{.Config}}</pre>
+</body>
+</html>
+`))
+
+type landingCollector struct {
+	Name   string
+	Help   string
+	Status *collector.CollectorStatus
+}
+
+// landingHandler 首页，显示版本、启用的collector和最近一次执行结果、当前配置(密码显示为<secret>)
+func landingHandler(scrapers []collector.Scraper) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		statuses := make(map[string]collector.CollectorStatus)
+		for _, s := range collector.Statuses() {
+			statuses[s.Name] = s
+		}
+		collectors := make([]landingCollector, 0, len(scrapers))
+		for _, scraper := range scrapers {
+			c := landingCollector{Name: scraper.Name(), Help: scraper.Help()}
+			if s, ok := statuses[scraper.Name()]; ok {
+				c.Status = &s
+			}
+			collectors = append(collectors, c)
+		}
+		sort.Slice(collectors, func(i, j int) bool {
+			return collectors[i].Name < collectors[j].Name
+		})
+		config := sc.Get()
+		out, err := yaml.Marshal(config)
+		if err != nil {
+			out = []byte(err.Error())
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		landingTemplate.Execute(w, struct {
+			MetricPath                                                 string
+			Version, Revision, Branch, BuildUser, BuildDate, GoVersion string
+			Collectors                                                 []landingCollector
+			ConfigFiles                                                []string
+			Config                                                     string
+		}{
+			MetricPath:  *metricPath,
+			Version:     version.Version,
+			Revision:    version.Revision,
+			Branch:      version.Branch,
+			BuildUser:   version.BuildUser,
+			BuildDate:   version.BuildDate,
+			GoVersion:   version.GoVersion,
+			Collectors:  collectors,
+			ConfigFiles: config.Files(),
+			Config:      string(out),
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"game_exporter/collector"
+	"github.com/go-kit/kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"time"
+)
+
+// probeHandler probes the target given in the query with a module from the
+// config, in the style of blackbox_exporter.
+func probeHandler(w http.ResponseWriter, r *http.Request, logger log.Logger) {
+	params := r.URL.Query()
+	target := params.Get("target")
+	if target == "" {
+		http.Error(w, "Target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	moduleName := params.Get("module")
+	module, ok := sc.Get().ProbeModules[moduleName]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown module %q", moduleName), http.StatusBadRequest)
+		return
+	}
+	if !module.TargetAllowed(target) {
+		http.Error(w, fmt.Sprintf("Target %q is not allowed for module %q", target, moduleName), http.StatusForbidden)
+		return
+	}
+	ctx, cancel := scrapeContext(r, logger)
+	defer cancel()
+
+	probeSuccessGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_success",
+		Help: "Displays whether or not the probe was a success",
+	})
+	probeDurationGauge := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_duration_seconds",
+		Help: "Returns how long the probe took to complete in seconds",
+	})
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(probeSuccessGauge, probeDurationGauge)
+
+	start := time.Now()
+	logger = log.With(logger, "module", moduleName, "target", target)
+	if collector.RunProbe(ctx, target, module, registry, logger) {
+		probeSuccessGauge.Set(1)
+	}
+	probeDurationGauge.Set(time.Since(start).Seconds())
+
+	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	h.ServeHTTP(w, r)
+}
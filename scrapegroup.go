@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"sync"
+)
+
+var (
+	scrapesInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "game",
+		Subsystem: "exporter",
+		Name:      "scrapes_in_flight",
+		Help:      "Number of on-demand collections currently running.",
+	})
+	scrapesQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "game",
+		Subsystem: "exporter",
+		Name:      "scrapes_queued",
+		Help:      "Number of on-demand collections waiting for --web.max-concurrent-scrapes.",
+	})
+	scrapesShared = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "game",
+		Subsystem: "exporter",
+		Name:      "scrapes_shared_total",
+		Help:      "Total number of scrape requests served by a collection started by another identical request.",
+	})
+	scrapesRejected = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "game",
+		Subsystem: "exporter",
+		Name:      "scrapes_rejected_total",
+		Help:      "Total number of scrape requests that timed out waiting for a free collection slot.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(scrapesInFlight, scrapesQueued, scrapesShared, scrapesRejected)
+}
+
+// errOverloaded 等待空闲的采集名额时请求已经超时
+var errOverloaded = errors.New("too many concurrent scrapes")
+
+// collection 一次进行中的采集，结束后关闭done
+type collection struct {
+	done     chan struct{}
+	families []*dto.MetricFamily
+	err      error
+	// 等待结果的请求数，全部离开后取消采集
+	waiters int
+	cancel  context.CancelFunc
+	// started 已经取得采集名额，没有取得时请求超时返回errOverloaded
+	started bool
+}
+
+// scrapeGroup 同时到达的相同请求(collect[]、exclude[]、参数和超时都相同)只采集一次，
+// 并限制同时进行的采集数量，超过时排队等待
+type scrapeGroup struct {
+	mu       sync.Mutex
+	inFlight map[string]*collection
+	// 采集名额，为nil时不限制
+	slots chan struct{}
+}
+
+func newScrapeGroup(maxConcurrent int) *scrapeGroup {
+	g := &scrapeGroup{inFlight: make(map[string]*collection)}
+	if maxConcurrent > 0 {
+		g.slots = make(chan struct{}, maxConcurrent)
+	}
+	return g
+}
+
+// do 执行gather，key相同的采集正在进行时等待并共享它的结果
+// 采集不受单个请求断开的影响，使用第一个请求的超时时间，所有等待的请求都离开后才取消
+func (g *scrapeGroup) do(ctx context.Context, key string, gather func(context.Context) ([]*dto.MetricFamily, error)) ([]*dto.MetricFamily, error) {
+	g.mu.Lock()
+	c, ok := g.inFlight[key]
+	if ok {
+		scrapesShared.Inc()
+	} else {
+		collectCtx, cancel := context.WithCancel(context.Background())
+		if deadline, ok := ctx.Deadline(); ok {
+			collectCtx, cancel = context.WithDeadline(context.Background(), deadline)
+		}
+		c = &collection{done: make(chan struct{}), cancel: cancel}
+		g.inFlight[key] = c
+		go g.collect(collectCtx, key, c, gather)
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.families, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		c.waiters--
+		if c.waiters == 0 {
+			// 之后到达的相同请求重新采集，不再共享已经取消的采集
+			c.cancel()
+			g.remove(key, c)
+		}
+		if !c.started {
+			return nil, errOverloaded
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (g *scrapeGroup) collect(ctx context.Context, key string, c *collection, gather func(context.Context) ([]*dto.MetricFamily, error)) {
+	defer c.cancel()
+	c.families, c.err = g.run(ctx, c, gather)
+	g.mu.Lock()
+	g.remove(key, c)
+	g.mu.Unlock()
+	close(c.done)
+}
+
+// remove 删除进行中的采集，key已经对应新的采集时不删除，调用时需要持有g.mu
+func (g *scrapeGroup) remove(key string, c *collection) {
+	if g.inFlight[key] == c {
+		delete(g.inFlight, key)
+	}
+}
+
+// run 取得采集名额后执行gather
+func (g *scrapeGroup) run(ctx context.Context, c *collection, gather func(context.Context) ([]*dto.MetricFamily, error)) ([]*dto.MetricFamily, error) {
+	if g.slots != nil {
+		select {
+		case g.slots <- struct{}{}:
+		default:
+			scrapesQueued.Inc()
+			select {
+			case g.slots <- struct{}{}:
+				scrapesQueued.Dec()
+			case <-ctx.Done():
+				scrapesQueued.Dec()
+				scrapesRejected.Inc()
+				return nil, errOverloaded
+			}
+		}
+		defer func() { <-g.slots }()
+	}
+	g.mu.Lock()
+	c.started = true
+	g.mu.Unlock()
+	scrapesInFlight.Inc()
+	defer scrapesInFlight.Dec()
+	return gather(ctx)
+}
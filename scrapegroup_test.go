@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	dto "github.com/prometheus/client_model/go"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitWaiters 等待key对应的采集有n个请求在等待
+func waitWaiters(t *testing.T, g *scrapeGroup, key string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		g.mu.Lock()
+		c, ok := g.inFlight[key]
+		waiters := 0
+		if ok {
+			waiters = c.waiters
+		}
+		g.mu.Unlock()
+		if waiters == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d waiters on %q", n, key)
+}
+
+func TestScrapeGroupShared(t *testing.T) {
+	g := newScrapeGroup(0)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	calls := 0
+	gather := func(ctx context.Context) ([]*dto.MetricFamily, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		<-release
+		return []*dto.MetricFamily{{}}, nil
+	}
+	results := make(chan []*dto.MetricFamily, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			families, err := g.do(context.Background(), "key", gather)
+			if err != nil {
+				t.Error(err)
+			}
+			results <- families
+		}()
+	}
+	waitWaiters(t, g, "key", 2)
+	close(release)
+	first, second := <-results, <-results
+	if len(first) != 1 || len(second) != 1 || first[0] != second[0] {
+		t.Fatalf("expected both requests to get the same result, got %v and %v", first, second)
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 collection, got %d", calls)
+	}
+}
+
+func TestScrapeGroupCancelAfterLastWaiter(t *testing.T) {
+	g := newScrapeGroup(0)
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	gather := func(ctx context.Context) ([]*dto.MetricFamily, error) {
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() {
+		_, err := g.do(ctx1, "key", gather)
+		errs <- err
+	}()
+	<-started
+	go func() {
+		_, err := g.do(ctx2, "key", gather)
+		errs <- err
+	}()
+	waitWaiters(t, g, "key", 2)
+
+	// 第一个请求断开后采集继续进行
+	cancel1()
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	select {
+	case <-cancelled:
+		t.Fatal("collection cancelled while a request is still waiting")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// 最后一个请求断开后取消采集
+	cancel2()
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("collection not cancelled after the last request left")
+	}
+	g.mu.Lock()
+	_, ok := g.inFlight["key"]
+	g.mu.Unlock()
+	if ok {
+		t.Fatal("cancelled collection is still shared")
+	}
+}
+
+func TestScrapeGroupOverloaded(t *testing.T) {
+	g := newScrapeGroup(1)
+	release := make(chan struct{})
+	go g.do(context.Background(), "busy", func(ctx context.Context) ([]*dto.MetricFamily, error) {
+		<-release
+		return nil, nil
+	})
+	defer close(release)
+	waitWaiters(t, g, "busy", 1)
+	// 等待占用名额的采集开始执行
+	for len(g.slots) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	called := false
+	_, err := g.do(ctx, "other", func(ctx context.Context) ([]*dto.MetricFamily, error) {
+		called = true
+		return nil, nil
+	})
+	if err != errOverloaded {
+		t.Fatalf("expected errOverloaded, got %v", err)
+	}
+	if called {
+		t.Fatal("collection ran without a free slot")
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"game_exporter/collector"
+	"html/template"
+	"net/http"
+)
+
+var statusTemplate = template.Must(template.New("status").Parse(`<html>
+<head><title>Game exporter status</title></head>
+<body>
+<h1>Collector status</h1>
+{{if .}}<table border="1" cellpadding="4">
+<tr><th>Collector</th><th>Last scrape</th><th>Duration</th><th>Success</th><th>Last error time</th><th>Last error</th></tr>
+{{range .}}<tr>
+<td>{{.Name}}</td>
+<td>{{.LastScrape.Format "2006-01-02 15:04:05"}}</td>
+<td>{{.LastDuration}}</td>
+<td>{{.LastSuccess}}</td>
+<td>{{if not .LastErrorTime.IsZero}}{{.LastErrorTime.Format "2006-01-02 15:04:05"}}{{end}}</td>
+<td>{{.LastError}}</td>
+</tr>
+{{end}}</table>
+{{else}}<p>No scrape yet.</p>
+{{end}}</body>
+</html>
+`))
+
+// statusHandler 显示每个collector最近一次执行的结果和最近一次错误
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	statusTemplate.Execute(w, collector.Statuses())
+}
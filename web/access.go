@@ -0,0 +1,204 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 匹配所有没有单独配置的路径
+const defaultEndpoint = "*"
+
+// allowed_cidrs中表示Unix socket的值
+const unixNetwork = "unix"
+
+// 超过这个数量的客户端时清理已经回满的令牌桶
+const maxRateBuckets = 10000
+
+// EndpointConfig 对应endpoints下每个路径的访问控制
+type EndpointConfig struct {
+	// AllowedCIDRs 允许访问的网段，也可以是单个IP或者unix(允许Unix socket上的请求)，为空时不限制
+	AllowedCIDRs []string `yaml:"allowed_cidrs"`
+	// RateLimit 每个客户端IP的令牌桶限速，不配置时不限速
+	RateLimit *RateLimitConfig `yaml:"rate_limit"`
+
+	nets      []*net.IPNet
+	allowUnix bool
+}
+
+// RateLimitConfig 令牌桶参数
+type RateLimitConfig struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	// Burst 桶的容量，默认为1
+	Burst int `yaml:"burst"`
+}
+
+var rejectedRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "game",
+	Subsystem: "exporter",
+	Name:      "http_requests_rejected_total",
+	Help:      "Total number of HTTP requests rejected by the IP allowlist or the rate limiter.",
+}, []string{"endpoint", "reason"})
+
+func init() {
+	prometheus.MustRegister(rejectedRequests)
+}
+
+func (e *EndpointConfig) validate() error {
+	e.nets = make([]*net.IPNet, 0, len(e.AllowedCIDRs))
+	for _, cidr := range e.AllowedCIDRs {
+		if cidr == unixNetwork {
+			e.allowUnix = true
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return fmt.Errorf("invalid IP %q", cidr)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			cidr = cidr + "/" + strconv.Itoa(bits)
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+		}
+		e.nets = append(e.nets, n)
+	}
+	if r := e.RateLimit; r != nil {
+		if r.RequestsPerSecond <= 0 {
+			return errors.New("rate_limit.requests_per_second must be positive")
+		}
+		if r.Burst < 0 {
+			return errors.New("rate_limit.burst must not be negative")
+		}
+		if r.Burst == 0 {
+			r.Burst = 1
+		}
+	}
+	return nil
+}
+
+// allowed 客户端IP是否在允许的网段中，Unix socket上的请求需要在allowed_cidrs中配置unix
+func (e *EndpointConfig) allowed(ip net.IP, unix bool) bool {
+	if len(e.nets) == 0 && !e.allowUnix {
+		return true
+	}
+	if unix {
+		return e.allowUnix
+	}
+	if ip == nil {
+		return false
+	}
+	for _, n := range e.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// endpoint 返回路径对应的访问控制和用于指标标签的名字，先精确匹配，再使用*
+func (c *Config) endpoint(path string) (string, *EndpointConfig) {
+	if e, ok := c.Endpoints[path]; ok {
+		return path, e
+	}
+	if e, ok := c.Endpoints[defaultEndpoint]; ok {
+		return defaultEndpoint, e
+	}
+	return "", nil
+}
+
+// rateLimiter 按endpoint和客户端IP分开的令牌桶，参数每次从当前配置传入
+type rateLimiter struct {
+	sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// allow 取一个令牌，没有令牌时返回需要等待的时间
+func (l *rateLimiter) allow(key string, cfg *RateLimitConfig, now time.Time) (bool, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+	if l.buckets == nil {
+		l.buckets = make(map[string]*bucket)
+	}
+	burst := float64(cfg.Burst)
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxRateBuckets {
+			l.cleanup(cfg, now)
+		}
+		b = &bucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*cfg.RequestsPerSecond)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / cfg.RequestsPerSecond
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// cleanup 删除已经回满的令牌桶，它们和新建的桶没有区别
+func (l *rateLimiter) cleanup(cfg *RateLimitConfig, now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*cfg.RequestsPerSecond >= float64(cfg.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// checkAccess 按请求路径检查IP白名单和限速，拒绝时写入响应并返回false
+func (h *webHandler) checkAccess(w http.ResponseWriter, r *http.Request, c *Config) bool {
+	name, e := c.endpoint(r.URL.Path)
+	if e == nil {
+		return true
+	}
+	ip, unix := clientIP(r.RemoteAddr), isUnixSocket(r)
+	if !e.allowed(ip, unix) {
+		rejectedRequests.WithLabelValues(name, "forbidden").Inc()
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return false
+	}
+	if e.RateLimit == nil {
+		return true
+	}
+	// Unix socket上的请求没有客户端IP，共用一个令牌桶
+	client := ip.String()
+	if unix {
+		client = unixNetwork
+	}
+	if ok, wait := h.limiter.allow(name+"\x00"+client, e.RateLimit, time.Now()); !ok {
+		rejectedRequests.WithLabelValues(name, "rate_limited").Inc()
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+// clientIP 取RemoteAddr中的IP，不信任X-Forwarded-For
+func clientIP(remoteAddr string) net.IP {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,115 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	unixPrefix = "unix://"
+	// systemd传递的第一个文件描述符，见sd_listen_fds(3)
+	listenFDsStart = 3
+)
+
+// Listen 按地址列表创建listener，unix:///path为Unix socket，其余为TCP地址
+// systemdSocket为true时还会使用systemd socket activation传递的socket(LISTEN_FDS)
+func Listen(addresses []string, systemdSocket bool) ([]net.Listener, error) {
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
+	if systemdSocket {
+		ls, err := systemdListeners()
+		if err != nil {
+			return nil, err
+		}
+		listeners = append(listeners, ls...)
+	}
+	for _, addr := range addresses {
+		l, err := listen(addr)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		listeners = append(listeners, l)
+	}
+	if len(listeners) == 0 {
+		return nil, errors.New("no address to listen on")
+	}
+	return listeners, nil
+}
+
+func listen(addr string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, unixPrefix) {
+		return net.Listen("tcp", addr)
+	}
+	path := strings.TrimPrefix(addr, unixPrefix)
+	if path == "" {
+		return nil, fmt.Errorf("invalid listen address %q: empty socket path", addr)
+	}
+	// 上次没有正常退出时会留下socket文件，只删除socket，不删除同名的普通文件
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("error removing stale socket %s: %w", path, err)
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	// Close时删除socket文件
+	l.(*net.UnixListener).SetUnlinkOnClose(true)
+	return l, nil
+}
+
+// systemdListeners 读取systemd传递的socket，读取后清除环境变量，避免被version.command等子进程继承
+func systemdListeners() ([]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, errors.New("no socket passed by systemd, LISTEN_PID is not set to this process")
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("no socket passed by systemd, invalid LISTEN_FDS %q", os.Getenv("LISTEN_FDS"))
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	var listeners []net.Listener
+	for i := 0; i < n; i++ {
+		fd := listenFDsStart + i
+		syscall.CloseOnExec(fd)
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(fd), name)
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("socket %s passed by systemd: %w", name, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// isUnixSocket 请求是否来自Unix socket，这类连接没有客户端IP
+func isUnixSocket(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && addr.Network() == "unix"
+}
@@ -0,0 +1,268 @@
+package web
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+)
+
+// Config 对应--web.config.file，格式和Prometheus的web配置相同
+// 每次TLS握手和每个请求都会重新读取配置文件，修改证书和用户后不需要重启
+type Config struct {
+	TLSConfig TLSConfig         `yaml:"tls_server_config"`
+	Users     map[string]string `yaml:"basic_auth_users"`
+	// Endpoints 按路径配置的IP白名单和限速，key为请求路径或*
+	Endpoints map[string]*EndpointConfig `yaml:"endpoints"`
+}
+
+// TLSConfig 服务端证书和客户端证书校验
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientAuth 客户端证书校验方式，例如RequireAndVerifyClientCert，默认不校验
+	ClientAuth string `yaml:"client_auth_type"`
+	ClientCAs  string `yaml:"client_ca_file"`
+	// MinVersion TLS10、TLS11、TLS12或TLS13，默认TLS12
+	MinVersion string `yaml:"min_version"`
+}
+
+var (
+	clientAuthTypes = map[string]tls.ClientAuthType{
+		"":                           tls.NoClientCert,
+		"NoClientCert":               tls.NoClientCert,
+		"RequestClientCert":          tls.RequestClientCert,
+		"RequireAnyClientCert":       tls.RequireAnyClientCert,
+		"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+		"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+	}
+	tlsVersions = map[string]uint16{
+		"":      tls.VersionTLS12,
+		"TLS10": tls.VersionTLS10,
+		"TLS11": tls.VersionTLS11,
+		"TLS12": tls.VersionTLS12,
+		"TLS13": tls.VersionTLS13,
+	}
+)
+
+// getConfig 读取并校验web配置，证书等相对路径相对于配置文件所在目录
+func getConfig(configPath string) (*Config, error) {
+	content, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading web config file: %w", err)
+	}
+	c := new(Config)
+	if err := yaml.UnmarshalStrict(content, c); err != nil {
+		return nil, fmt.Errorf("error parsing web config file %s: %w", configPath, err)
+	}
+	dir := filepath.Dir(configPath)
+	for _, p := range []*string{&c.TLSConfig.CertFile, &c.TLSConfig.KeyFile, &c.TLSConfig.ClientCAs} {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("invalid web config file %s: %w", configPath, err)
+	}
+	return c, nil
+}
+
+func (c *Config) validate() error {
+	t := c.TLSConfig
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return errors.New("cert_file and key_file must be set together")
+	}
+	clientAuth, ok := clientAuthTypes[t.ClientAuth]
+	if !ok {
+		return fmt.Errorf("unknown client_auth_type %q", t.ClientAuth)
+	}
+	if t.CertFile == "" && (clientAuth != tls.NoClientCert || t.ClientCAs != "") {
+		return errors.New("client certificate auth needs cert_file and key_file")
+	}
+	if t.ClientCAs != "" && clientAuth == tls.NoClientCert {
+		return errors.New("client_ca_file is set but client_auth_type is NoClientCert")
+	}
+	if (clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert) && t.ClientCAs == "" {
+		return fmt.Errorf("client_auth_type %s needs client_ca_file", t.ClientAuth)
+	}
+	if _, ok := tlsVersions[t.MinVersion]; !ok {
+		return fmt.Errorf("unknown min_version %q", t.MinVersion)
+	}
+	for path, e := range c.Endpoints {
+		if e == nil {
+			return fmt.Errorf("endpoints %q: empty config", path)
+		}
+		if err := e.validate(); err != nil {
+			return fmt.Errorf("endpoints %q: %w", path, err)
+		}
+	}
+	for user, hash := range c.Users {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("basic_auth_users %q: password is not a bcrypt hash: %w", user, err)
+		}
+	}
+	return nil
+}
+
+// tlsEnabled 没有配置证书时使用HTTP，只做basic auth
+func (c *Config) tlsEnabled() bool {
+	return c.TLSConfig.CertFile != ""
+}
+
+// newTLSConfig 加载证书和客户端CA
+func newTLSConfig(t TLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load X509KeyPair: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   clientAuthTypes[t.ClientAuth],
+		MinVersion:   tlsVersions[t.MinVersion],
+	}
+	if t.ClientCAs != "" {
+		pem, err := ioutil.ReadFile(t.ClientCAs)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client_ca_file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in client_ca_file %s", t.ClientCAs)
+		}
+		cfg.ClientCAs = pool
+	}
+	return cfg, nil
+}
+
+func getTLSConfig(configPath string) (*tls.Config, error) {
+	c, err := getConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if !c.tlsEnabled() {
+		return nil, errors.New("tls_server_config was removed, restart the exporter to switch to HTTP")
+	}
+	return newTLSConfig(c.TLSConfig)
+}
+
+// webHandler 校验IP白名单、限速和basic auth后调用原来的handler
+type webHandler struct {
+	handler    http.Handler
+	configPath string
+	logger     log.Logger
+	limiter    rateLimiter
+
+	// bcrypt很慢，缓存校验通过的用户名、hash和密码；失败的不缓存，避免被随机密码占满内存
+	cache sync.Map
+}
+
+var (
+	// 用户不存在时也做一次bcrypt比较，避免通过响应时间判断用户是否存在
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+func (h *webHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c, err := getConfig(h.configPath)
+	if err != nil {
+		level.Error(h.logger).Log("msg", "Unable to parse configuration", "err", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	// 先检查IP和限速，被拒绝的请求不会消耗bcrypt的CPU
+	if !h.checkAccess(w, r, c) {
+		return
+	}
+	if len(c.Users) == 0 {
+		h.handler.ServeHTTP(w, r)
+		return
+	}
+	user, pass, ok := r.BasicAuth()
+	if ok {
+		hash, exists := c.Users[user]
+		if !exists {
+			dummyHashOnce.Do(func() {
+				dummyHash, _ = bcrypt.GenerateFromPassword([]byte("game_exporter"), bcrypt.DefaultCost)
+			})
+			hash = string(dummyHash)
+		}
+		if h.checkPassword(user, hash, pass) && exists {
+			h.handler.ServeHTTP(w, r)
+			return
+		}
+	}
+	w.Header().Set("WWW-Authenticate", "Basic")
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+func (h *webHandler) checkPassword(user, hash, pass string) bool {
+	key := sha256.Sum256([]byte(user + "\x00" + hash + "\x00" + pass))
+	if _, ok := h.cache.Load(key); ok {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) != nil {
+		return false
+	}
+	h.cache.Store(key, true)
+	return true
+}
+
+// Serve 按照web配置在所有listener上启动HTTP或HTTPS服务，返回第一个出错的listener的错误
+// server.Shutdown后返回http.ErrServerClosed
+func Serve(server *http.Server, listeners []net.Listener, configPath string, logger log.Logger) error {
+	tlsEnabled := false
+	if configPath != "" {
+		c, err := getConfig(configPath)
+		if err != nil {
+			return err
+		}
+		handler := server.Handler
+		if handler == nil {
+			handler = http.DefaultServeMux
+		}
+		server.Handler = &webHandler{
+			handler:    handler,
+			configPath: configPath,
+			logger:     logger,
+		}
+		if c.tlsEnabled() {
+			cfg, err := newTLSConfig(c.TLSConfig)
+			if err != nil {
+				return err
+			}
+			// 每次握手重新读取配置，证书更新后不需要重启
+			cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+				return getTLSConfig(configPath)
+			}
+			server.TLSConfig = cfg
+			tlsEnabled = true
+		}
+	}
+	if tlsEnabled {
+		level.Info(logger).Log("msg", "TLS is enabled.")
+	} else {
+		level.Info(logger).Log("msg", "TLS is disabled.")
+	}
+	errCh := make(chan error, len(listeners))
+	for _, l := range listeners {
+		level.Info(logger).Log("msg", "Listening on address", "address", l.Addr())
+		go func(l net.Listener) {
+			if tlsEnabled {
+				errCh <- server.ServeTLS(l, "", "")
+			} else {
+				errCh <- server.Serve(l)
+			}
+		}(l)
+	}
+	return <-errCh
+}